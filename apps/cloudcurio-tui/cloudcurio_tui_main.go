@@ -1,3 +1,8 @@
+//go:build ignore
+
+// Superseded by main.go; kept for reference and excluded from the build
+// so the package has a single main.
+
 // ============================================================================
 // File:        main.go
 // Project:     cloudcurio-tui
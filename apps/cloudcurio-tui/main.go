@@ -6,25 +6,63 @@
 //
 // Summary:
 //   Reusable TUI dashboard for managing the CloudCurio repo ecosystem.
-//   - Left pane: repo list (scans CC_ROOT for repos)
+//   - Left pane: repo list (scans CC_ROOT for repos, with each repo's git
+//     branch and dirty state filled in as it is looked up)
 //   - Center pane: rendered project docs (PROJECT_SUMMARY.md, RULES.md, etc.)
-//   - Right pane: AI sidebar (chat pane + input), wired to OpenAI/OpenRouter via env vars.
+//   - Right pane: AI sidebar (chat pane + input), wired to OpenAI/OpenRouter/Gemini via env vars.
 //   - Includes project validator to ensure required docs exist per repo.
 //   - Provides hotkeys to switch docs, validate repos, and query AI.
 //   - Supports layout profiles (default/infra/agents) and a simple command palette.
 //   - Can run as a local TUI or as an SSH app via Charmbracelet Wish.
 //
 // Inputs / Configuration:
-//   Environment variables:
+//   Config file (YAML): ~/.config/cloudcurio/tui.yaml, overridable via CC_CONFIG.
+//   See Config for the available keys. Environment variables take precedence
+//   over the file when set:
+//     CC_CONFIG            - path to the YAML config file
+//   State file: ~/.cache/cloudcurio/tui_state.json remembers the last repo/doc
+//   (disable with "persist_state: false", e.g. for shared SSH deployments).
 //     CC_ROOT              - root directory for CloudCurio repos (default: ~/dev/cloudcurio)
-//     CC_THEME             - (optional) theme hint, e.g. "dark", "light" (not strictly used yet)
+//     CC_THEME             - (optional) "dark" or "light"; anything else auto-detects
 //     OPENAI_API_KEY       - (optional) if set, use OpenAI Chat Completions API
 //     OPENAI_MODEL         - (optional) OpenAI model name (default: gpt-4.1-mini)
 //     OPENROUTER_API_KEY   - (optional) if set and OPENAI_API_KEY not set, use OpenRouter
 //     OPENROUTER_MODEL     - (optional) OpenRouter model (default: openrouter/auto)
+//     GEMINI_API_KEY       - (optional) if set and neither key above is set, use Gemini
+//     GEMINI_MODEL         - (optional) Gemini model (default: gemini-1.5-flash)
+//     OPENAI_TEMPERATURE / OPENROUTER_TEMPERATURE / GEMINI_TEMPERATURE
+//                          - (optional) sampling temperature
+//     OPENAI_MAX_TOKENS / OPENROUTER_MAX_TOKENS / GEMINI_MAX_TOKENS
+//                          - (optional) response length cap
+//                          (both omitted from requests unless set)
 //     CC_TUI_SSH_SERVER    - if "1", run as SSH server instead of local TUI
 //     CC_TUI_SSH_ADDR      - SSH listen address (default ":23234")
 //     CC_TUI_SSH_KEY       - SSH host key path (default: ~/.ssh/cloudcurio_tui)
+//     CC_TUI_SSH_AUTHORIZED_KEYS - authorized_keys file for SSH public-key auth
+//                            (default: ~/.ssh/cloudcurio_tui_authorized_keys)
+//     CC_TUI_SSH_MAX_SESSIONS - (optional) cap on concurrent SSH sessions;
+//                            extra clients are turned away (default: no limit)
+//     CC_TUI_SSH_ROOT_TEMPLATE - per-user CC_ROOT in SSH mode; "{user}" is replaced
+//                            with the owner named in the matched authorized_keys
+//                            entry's comment, when it equals the SSH username
+//                            (default: /home/{user}/dev/cloudcurio)
+//     EDITOR               - (optional) external editor for the 'e' key (default: vim)
+//     CC_AI_NOTIFY         - (optional) "bell" or "osc9" to signal when an AI
+//                            response arrives (default: off)
+//     CC_AI_REQUESTS_PER_MINUTE - (optional) cap on AI requests per minute for
+//                            the whole process; excess calls are rejected
+//                            locally (default: no limit)
+//     CC_AI_SYSTEM_PROMPT  - (optional) system message for AI requests; a repo's
+//                            .cc-ai-system.md takes precedence (default: a
+//                            generic CloudCurio assistant prompt)
+//     CC_LOG_FILE          - log file for AI calls, scans and errors
+//                            (default: ~/.cache/cloudcurio/tui.log)
+//     CC_LOG_LEVEL         - debug, info (default), warn or error
+//
+// Flags:
+//   -dump-state          - print CC_ROOT, the repos with their git state and
+//                          missing docs, and the active config (API keys
+//                          masked) as JSON, then exit without starting the UI
 //
 // Outputs:
 //   - Interactive terminal UI using Bubble Tea.
@@ -32,21 +70,50 @@
 //   - Validation report rendered in main pane.
 //   - Optional SSH app entrypoint powered by Wish.
 //
-// Keybindings:
+// Keybindings (defaults; remap any action under "keys:" in the config file):
 //   Global:
 //     Up/Down            : Navigate repo list
 //     Enter              : In repos pane, load PROJECT_SUMMARY.md
-//                          In AI pane, submit prompt to LLM
+//                          In AI pane, insert a newline (submits when
+//                          "ai.single_line_input: true")
+//     Ctrl+S / Alt+Enter : In AI pane, submit the prompt to the LLM
+//     Up/Down            : In AI pane, on the first/last line of the prompt,
+//                          recall earlier/later prompts from this session
+//     Ctrl+L / :clear    : Clear the AI conversation (and the repo's
+//                          .cc-chat.jsonl log)
+//     :context           : Preview the messages the AI prompt would send
+//                          (system prompt, repo context with the docs picked
+//                          for the prompt, recent chat turns, prompt) in the
+//                          main pane without calling the API
 //     Tab                : Cycle active pane (Repos -> Main -> AI -> ...)
 //     a                  : Toggle AI sidebar (show/hide)
+//     + / -              : Widen / narrow the focused pane (repos or main);
+//                          defaults from layout.repo_ratio / layout.ai_ratio,
+//                          changes are saved in the state file
 //     v                  : Validate all repos (required doc set)
+//     p                  : Pin/unpin the selected repo; pinned repos are
+//                          listed first (marked ★) in every layout
 //     :                  : Open command palette (e.g. "validate", "open RULES", "layout infra")
 //     1                  : Layout profile: default (all repos)
 //     2                  : Layout profile: infra-focused
 //     3                  : Layout profile: agents-focused
+//     P / :pull          : git pull --ff-only in the selected repo; output is
+//                          shown in the main pane
+//     :refresh           : Rescan CC_ROOT for repos (an empty list explains
+//                          whether CC_ROOT is missing or has no repos)
+//     :sort <key>        : Order repos by name, mtime (newest first) or size
+//                          (largest first; sizes are computed on first use)
 //     q / Ctrl+C         : Quit TUI
+//     Mouse              : Click a pane to focus it, click a repo to select it,
+//                          wheel scrolls the focused pane (disable: "mouse: false")
+//
+//   Confirmation:
+//     Actions that change files (P / :pull, :new-repo, e, :ai-scaffold,
+//     clearing a saved chat log) first show a yes/no prompt over the
+//     layout: y goes ahead, n or Esc cancels; other keys are ignored.
 //
-//   Repo doc shortcuts (when a repo is selected):
+//   Repo doc shortcuts (when a repo is selected; the "docs" config list
+//   replaces these defaults with file / key / aliases entries):
 //     s                  : Show PROJECT_SUMMARY.md
 //     r                  : Show RULES.md
 //     g                  : Show AGENTS.md
@@ -55,38 +122,166 @@
 //     k                  : Show SRS.md
 //     t                  : Show TASKS.md
 //     y                  : Show TESTING.md
+//     e                  : Open the loaded doc in $EDITOR (local mode only)
+//     [ / ]              : Back / forward through docs viewed this session
+//                          (also Alt+Left / Alt+Right)
+//     x                  : Show/hide the full text of the last error
+//     S / :summarize     : Ask the AI backend for an overview of the repo built
+//                          from PROJECT_SUMMARY.md, RULES.md and AGENTS.md
+//     :ai-file <path>    : Send a prompt file, rendered as a text/template
+//                          with {{.Repo}}, {{.RepoPath}}, {{.Doc}}, {{.Root}}
+//     :ai-scaffold <doc> : Draft a missing doc (e.g. "SRS") from the repo's other
+//                          docs; y writes it (never overwrites), n discards
+//                          (via the confirmation prompt)
+//
+//   AI model picker:
+//     m                  : Pick the AI model from the backend's /models list
+//                          (fetched once per session; without an API key only
+//                          the configured and manually entered models are shown)
+//     :model <name>      : Use <name> directly and add it to the picker
+//     :temp <t|default>  : Set the active backend's temperature for this session
+//     :max-tokens <n|default> : Set the active backend's max_tokens likewise
+//
+//   Create:
+//     :new-repo <name> [--git] : Create CC_ROOT/<name> with every required doc
+//                          (from templates_dir when present), optionally git init
+//
+//   Split view:
+//     :split <doc>       : Show <doc> (alias or filename) from the same repo
+//                          beside the loaded doc (stacked on narrow terminals)
+//     w                  : Switch scrolling between the two halves
+//     W / :unsplit       : Close the split
+//
+//   Compare:
+//     :diff <repoA> <repoB> <doc> : Colorized unified diff of a doc (alias or
+//                          filename) between two repos
+//
+//   Search:
+//     :grep <regex>      : Search the required docs of every repo; results
+//                          list in the main pane, Enter jumps, Esc closes
+//     :grep -a <regex>   : Same, across all .md files in each repo
 //
 // Modification Log:
 //   2025-11-15 - Initial scaffold with pane layout and markdown render.
 //   2025-11-16 - Added AI sidebar wiring (OpenAI/OpenRouter),
 //                validation command, doc hotkeys, layout profiles,
 //                command palette, and Wish-based SSH server mode.
+//   2026-10-16 - Added 'e' to open the loaded doc in an external editor.
+//              - Markdown word-wrap now follows the main pane width.
+//              - CC_THEME selects dark/light glamour and lipgloss styling.
+//              - SSH server checks public keys against an authorized_keys file,
+//                cached by mtime; unparsable entries are logged and skipped.
+//              - SSH sessions get a per-user CC_ROOT from a path template,
+//                only with public-key auth and an SSH username matching the
+//                key's authorized_keys comment.
+//              - Added YAML config file (LoadConfig) with env var overrides.
+//              - Keybindings are looked up from a configurable key map.
+//              - Last selected repo and doc are saved on quit and restored.
+//              - Mouse support: click to focus panes/select repos, wheel scrolls.
+//              - AI pane shows a spinner and elapsed time while waiting.
+//              - Model picker ('m') lists models fetched from the active backend.
+//              - Rendered markdown is cached per (path, mtime, wrap width).
+//              - The displayed doc is polled and reloaded when it changes on disk.
+//              - ":grep [-a] <regex>" searches repo docs concurrently.
+//              - 'S' / ":summarize" asks the AI backend to summarize the repo docs.
+//              - ":ai-scaffold <doc>" drafts a missing doc with AI, written on confirm.
+//              - Optional temperature / max_tokens per backend (env, config, :temp).
+//              - Status bar shows the active AI backend and model.
+//              - 'x' toggles an error pane with the full text of the last error.
+//              - ":diff <repoA> <repoB> <doc>" shows a unified diff of a doc.
+//              - ":new-repo <name> [--git]" scaffolds a repo with the required docs.
+//              - CC_ROOT is scanned in the background; git branch/dirty state
+//                streams in from a bounded worker pool.
+//              - AI prompt box is a multi-line textarea (Ctrl+S submits);
+//                "ai.single_line_input" restores the one-line input.
+//              - Up/Down at the edge of the AI prompt recall earlier prompts.
+//              - ":clear" / Ctrl+L (AI pane) empties the AI conversation.
+//              - Status line key hints follow the active pane.
+//              - ":split <doc>" shows a second doc beside the first; w switches
+//                halves, W (or ":unsplit") closes the split.
+//              - Loading a doc reports its word count and reading time.
+//              - [ / ] (Alt+Left/Right) step back and forward through viewed docs.
+//              - p pins the selected repo to the top of the list (saved in the
+//                state file).
+//              - ":sort <name|mtime|size>" (default: repo_sort) orders the repo list.
+//              - P / ":pull" fast-forwards the selected repo, streaming git's output.
+//              - ":context" previews the assembled AI messages without sending.
+//              - Leveled slog logging to CC_LOG_FILE (CC_LOG_LEVEL) replaces
+//                stderr output, which drew over the TUI.
+//              - An empty repo list says whether CC_ROOT is missing, unreadable
+//                or empty; ":refresh" rescans it.
+//              - Opt-in bell / OSC 9 notification when an AI response arrives
+//                (ai.notify, CC_AI_NOTIFY), written to the session's terminal.
+//              - ":ai-file <path>" sends a prompt template rendered for the
+//                selected repo and doc.
+//              - Optional token-bucket limit on AI requests per minute
+//                (ai.requests_per_minute, CC_AI_REQUESTS_PER_MINUTE).
+//              - SSH server shuts down gracefully on SIGINT/SIGTERM.
+//              - SSH sessions are logged on connect/disconnect and capped by
+//                ssh.max_sessions (CC_TUI_SSH_MAX_SESSIONS).
+//              - Pane widths come from layout.repo_ratio / layout.ai_ratio;
+//                +/- resize the focused pane and the result is persisted.
+//              - "-dump-state" prints the dashboard's view as JSON for scripts.
+//              - Gemini backend (GEMINI_API_KEY / GEMINI_MODEL) via generateContent.
+//              - AI questions carry the one or two required docs that score
+//                best against the prompt (local TF-IDF); the status line
+//                names them.
+//              - The AI conversation is kept per repo in <repo>/.cc-chat.jsonl,
+//                loaded when the AI pane is focused; ":clear" truncates it.
+//                Its last turns are sent with each question.
+//              - The AI system prompt comes from the repo's .cc-ai-system.md,
+//                ai.system_prompt (CC_AI_SYSTEM_PROMPT) or the built-in default.
+//              - Actions that write files go through a shared y/n confirmation
+//                overlay (pending action stored on the model).
+//              - The doc shortcuts (file, key, aliases) come from the "docs"
+//                config list, defaulting to the original eight.
 // ============================================================================
 
 package main
 
 import (
+    "bufio"
     "bytes"
+    "context"
     "encoding/json"
+    "errors"
+    "flag"
     "fmt"
     "io"
     "log"
+    "log/slog"
+    "math"
     "net/http"
     "os"
+    "os/exec"
+    "os/signal"
     "path/filepath"
+    "regexp"
+    "sort"
+    "strconv"
     "strings"
+    "sync"
+    "syscall"
+    "text/template"
     "time"
+    "unicode"
 
     tea "github.com/charmbracelet/bubbletea"
     "github.com/charmbracelet/bubbles/list"
+    "github.com/charmbracelet/bubbles/spinner"
+    "github.com/charmbracelet/bubbles/textarea"
     "github.com/charmbracelet/bubbles/textinput"
     "github.com/charmbracelet/bubbles/viewport"
     "github.com/charmbracelet/glamour"
     "github.com/charmbracelet/lipgloss"
+    "github.com/charmbracelet/x/ansi"
     bm "github.com/charmbracelet/wish/bubbletea"
     wlog "github.com/charmbracelet/wish/logging"
     "github.com/charmbracelet/wish"
     "github.com/gliderlabs/ssh"
+    "github.com/pmezard/go-difflib/difflib"
+    gossh "golang.org/x/crypto/ssh"
+    "gopkg.in/yaml.v3"
 )
 
 // ---------------------------------------------------------------------
@@ -110,15 +305,55 @@ const (
     profileAgents
 )
 
-// repoItem is an item for the repo list pane.
+// repoItem is an item for the repo list pane. git is nil until the
+// repo's git state has been looked up.
 type repoItem struct {
-    name string
-    path string
+    name   string
+    path   string
+    git    *gitState
+    pinned bool
 }
 
-func (r repoItem) Title() string       { return r.name }
-func (r repoItem) Description() string { return r.path }
-func (r repoItem) FilterValue() string { return r.name }
+// pinMarker prefixes the titles of pinned repos.
+const pinMarker = "★ "
+
+func (r repoItem) Title() string {
+    if r.pinned {
+        return pinMarker + r.name
+    }
+    return r.name
+}
+func (r repoItem) Description() string {
+    if r.git == nil || r.git.branch == "" {
+        return r.path
+    }
+    return r.path + " · " + r.git.String()
+}
+func (r repoItem) FilterValue() string { return r.Title() }
+
+// placeholderItem is a non-repo row, shown while CC_ROOT is scanned or
+// when the scan found no repos.
+type placeholderItem string
+
+func (p placeholderItem) Title() string       { return string(p) }
+func (p placeholderItem) Description() string { return "" }
+func (p placeholderItem) FilterValue() string { return "" }
+
+// reposLoadedMsg carries the result of the background CC_ROOT scan. err
+// is set when CC_ROOT could not be read; rescan marks a ":refresh", which
+// keeps the current selection instead of restoring the saved state.
+type reposLoadedMsg struct {
+    items  []list.Item
+    err    error
+    rescan bool
+}
+
+// gitStateMsg carries one repo's git state; next waits for the one after.
+type gitStateMsg struct {
+    path  string
+    state gitState
+    next  tea.Cmd
+}
 
 // aiResponseMsg carries the result of an AI call back into the TUI.
 type aiResponseMsg struct {
@@ -126,6 +361,771 @@ type aiResponseMsg struct {
     err      error
 }
 
+// modelsLoadedMsg carries the model IDs fetched from the AI backend.
+type modelsLoadedMsg struct {
+    backend string
+    models  []modelItem
+    err     error
+}
+
+// modelItem is an entry in the AI model picker.
+type modelItem struct {
+    id   string
+    desc string
+}
+
+func (i modelItem) Title() string       { return i.id }
+func (i modelItem) Description() string { return i.desc }
+func (i modelItem) FilterValue() string { return i.id }
+
+// pullOutputMsg is one line of git pull output; next waits for the rest.
+type pullOutputMsg struct {
+    line string
+    next tea.Cmd
+}
+
+// pullDoneMsg reports how a git pull ended; output is everything it wrote.
+type pullDoneMsg struct {
+    repo   repoItem
+    output string
+    err    error
+}
+
+// repoSizesMsg carries freshly computed repo sizes, keyed by path.
+type repoSizesMsg struct {
+    sizes map[string]int64
+}
+
+// grepResultsMsg carries the hits of a :grep search.
+type grepResultsMsg struct {
+    pattern string
+    hits    []grepHit
+    files   int
+}
+
+// grepHit is one matching line, listed in the grep results pane.
+type grepHit struct {
+    repo string
+    path string // absolute
+    rel  string // relative to the repo
+    line int
+    text string
+}
+
+func (h grepHit) Title() string       { return fmt.Sprintf("%s/%s:%d", h.repo, h.rel, h.line) }
+func (h grepHit) Description() string { return h.text }
+func (h grepHit) FilterValue() string { return h.repo + "/" + h.rel + " " + h.text }
+
+// scaffoldDraftMsg carries an AI-drafted doc for :ai-scaffold.
+type scaffoldDraftMsg struct {
+    path  string
+    draft string
+    err   error
+}
+
+// newRepoMsg reports the outcome of :new-repo.
+type newRepoMsg struct {
+    name  string
+    path  string
+    steps []string
+    err   error
+}
+
+// docCheckMsg is the periodic tick that checks the displayed doc for
+// changes on disk.
+type docCheckMsg struct{}
+
+// flashExpiredMsg clears a transient status note; id guards against
+// clearing a newer flash.
+type flashExpiredMsg struct{ id int }
+
+// editorFinishedMsg is sent when an external editor session returns.
+type editorFinishedMsg struct {
+    path string
+    err  error
+}
+
+// ---------------------------------------------------------------------
+// Configuration
+// ---------------------------------------------------------------------
+
+// Config is the TUI configuration loaded from the YAML config file, with
+// environment variables applied on top.
+type Config struct {
+    Root         string    `yaml:"root"`
+    Theme        string    `yaml:"theme"`
+    RequiredDocs []string  `yaml:"required_docs"`
+    AI           AIConfig  `yaml:"ai"`
+    SSH          SSHConfig `yaml:"ssh"`
+
+    // PersistState saves the selected repo and doc to StatePath on quit
+    // and restores them on the next launch.
+    PersistState bool   `yaml:"persist_state"`
+    StatePath    string `yaml:"state_path"`
+
+    // Mouse enables mouse reporting for pane focus and wheel scrolling.
+    Mouse bool `yaml:"mouse"`
+
+    // RepoSort is the initial repo list order: "name", "mtime" or "size".
+    RepoSort string `yaml:"repo_sort"`
+
+    // TemplatesDir holds optional doc templates for :new-repo, one file per
+    // required doc name. "{{name}}" in a template becomes the repo name.
+    TemplatesDir string `yaml:"templates_dir"`
+
+    // Keys maps action names (see defaultKeyBindings) to one or more keys.
+    // Actions not listed keep their default keys.
+    Keys map[string][]string `yaml:"keys"`
+
+    // Docs lists the repo docs with a shortcut key and the aliases
+    // accepted by :open, :split, :diff and :ai-scaffold, in hint order.
+    // Setting it replaces the built-in list (see defaultDocs).
+    Docs []DocShortcut `yaml:"docs"`
+
+    // Layout sets the pane widths as fractions of the terminal width.
+    Layout LayoutConfig `yaml:"layout"`
+
+    // LogFile receives the leveled log (AI calls, scans, errors) so it
+    // never draws over the TUI. LogLevel is debug, info, warn or error.
+    LogFile  string `yaml:"log_file"`
+    LogLevel string `yaml:"log_level"`
+}
+
+// DocShortcut binds a repo doc to a key and aliases. Key may be empty for
+// a doc reached only by alias. Each doc is also an action named
+// "show_<name>" (see action) that the "keys" section can rebind.
+type DocShortcut struct {
+    File    string   `yaml:"file"`
+    Key     string   `yaml:"key,omitempty"`
+    Aliases []string `yaml:"aliases,omitempty"`
+}
+
+// action returns the doc's key binding action: "show_" plus its first
+// alias, or the lowercased file name without extension.
+func (d DocShortcut) action() string {
+    if len(d.Aliases) > 0 {
+        return "show_" + strings.ToLower(d.Aliases[0])
+    }
+    return "show_" + strings.ToLower(strings.TrimSuffix(d.File, filepath.Ext(d.File)))
+}
+
+// matches reports whether alias (lowercased) names the doc: one of its
+// aliases, its key, or its file name with or without the extension.
+func (d DocShortcut) matches(alias string) bool {
+    file := strings.ToLower(d.File)
+    if alias == file || alias == strings.TrimSuffix(file, filepath.Ext(file)) || (d.Key != "" && alias == strings.ToLower(d.Key)) {
+        return true
+    }
+    for _, a := range d.Aliases {
+        if alias == strings.ToLower(a) {
+            return true
+        }
+    }
+    return false
+}
+
+// LayoutConfig holds the repo and AI pane widths as fractions of the
+// terminal width; the main pane gets the rest. The repo pane keeps the
+// same share of the non-AI width when the AI pane is hidden.
+type LayoutConfig struct {
+    RepoRatio float64 `yaml:"repo_ratio"`
+    AIRatio   float64 `yaml:"ai_ratio"`
+}
+
+// AIConfig selects and configures the AI backend. Backend may be "openai",
+// "openrouter", "gemini", or empty to pick the first backend with an API
+// key.
+type AIConfig struct {
+    Backend    string          `yaml:"backend"`
+    OpenAI     AIBackendConfig `yaml:"openai"`
+    OpenRouter AIBackendConfig `yaml:"openrouter"`
+    Gemini     AIBackendConfig `yaml:"gemini"`
+
+    // Models are extra model names always offered in the model picker,
+    // e.g. ones the backend does not list or when no API key is set.
+    Models []string `yaml:"models"`
+
+    // SingleLineInput uses a one-line prompt box where Enter submits,
+    // instead of the multi-line box where Enter inserts a newline.
+    SingleLineInput bool `yaml:"single_line_input"`
+
+    // Notify signals when an AI response arrives: "bell" rings the
+    // terminal bell, "osc9" sends an OSC 9 desktop notification, and ""
+    // or "off" (the default) stays quiet.
+    Notify string `yaml:"notify"`
+
+    // RequestsPerMinute caps outbound AI requests for the whole process
+    // (all SSH sessions included); 0, the default, means no limit.
+    RequestsPerMinute int `yaml:"requests_per_minute"`
+
+    // SystemPrompt replaces the built-in system message. A repo's own
+    // .cc-ai-system.md still takes precedence; see systemPromptFor.
+    SystemPrompt string `yaml:"system_prompt"`
+}
+
+// label describes the active backend for display, e.g.
+// "openai/gpt-4.1-mini", or "none (set a key)" when no key is configured.
+func (c AIConfig) label() string {
+    name, backend, ok := c.active()
+    if !ok {
+        return "none (set a key)"
+    }
+    return name + "/" + backend.Model
+}
+
+// active returns the name and settings of the backend AI calls will use.
+// With no explicit backend the first with a key wins, in the order
+// OpenAI, OpenRouter, Gemini. When no key is configured it still returns
+// the selected (or first) backend so its model can be changed; ok reports
+// whether it has an API key.
+func (c *AIConfig) active() (name string, backend *AIBackendConfig, ok bool) {
+    useOpenAI := c.OpenAI.APIKey != "" && (c.Backend == "" || c.Backend == "openai")
+    useOpenRouter := c.OpenRouter.APIKey != "" && (c.Backend == "" || c.Backend == "openrouter")
+    useGemini := c.Gemini.APIKey != "" && (c.Backend == "" || c.Backend == "gemini")
+
+    switch {
+    case useOpenAI:
+        return "openai", &c.OpenAI, true
+    case useOpenRouter:
+        return "openrouter", &c.OpenRouter, true
+    case useGemini:
+        return "gemini", &c.Gemini, true
+    case c.Backend == "openrouter":
+        return "openrouter", &c.OpenRouter, false
+    case c.Backend == "gemini":
+        return "gemini", &c.Gemini, false
+    default:
+        return "openai", &c.OpenAI, false
+    }
+}
+
+// AIBackendConfig holds the credentials and model for one AI backend.
+// Temperature and MaxTokens are nil when unset so the server defaults apply.
+type AIBackendConfig struct {
+    APIKey      string   `yaml:"api_key"`
+    Model       string   `yaml:"model"`
+    Temperature *float64 `yaml:"temperature"`
+    MaxTokens   *int     `yaml:"max_tokens"`
+}
+
+// SSHConfig controls the Wish-based SSH server mode.
+type SSHConfig struct {
+    Enabled        bool   `yaml:"enabled"`
+    Addr           string `yaml:"addr"`
+    HostKey        string `yaml:"host_key"`
+    AuthorizedKeys string `yaml:"authorized_keys"`
+    RootTemplate   string `yaml:"root_template"`
+
+    // MaxSessions caps concurrent SSH sessions; clients over the cap are
+    // turned away with a message. 0 means no limit.
+    MaxSessions int `yaml:"max_sessions"`
+}
+
+// defaultDocs returns the built-in doc shortcuts.
+func defaultDocs() []DocShortcut {
+    return []DocShortcut{
+        {File: "PROJECT_SUMMARY.md", Key: "s", Aliases: []string{"summary", "project"}},
+        {File: "RULES.md", Key: "r", Aliases: []string{"rules"}},
+        {File: "AGENTS.md", Key: "g", Aliases: []string{"agents"}},
+        {File: "INSTRUCTIONS.md", Key: "i", Aliases: []string{"instructions"}},
+        {File: "JOURNAL.md", Key: "j", Aliases: []string{"journal"}},
+        {File: "SRS.md", Key: "k", Aliases: []string{"srs"}},
+        {File: "TASKS.md", Key: "t", Aliases: []string{"tasks"}},
+        {File: "TESTING.md", Key: "y", Aliases: []string{"testing", "test"}},
+    }
+}
+
+// defaultConfig returns the built-in configuration used when no config
+// file or env vars are present.
+func defaultConfig(home string) Config {
+    return Config{
+        Root:         filepath.Join(home, "dev", "cloudcurio"),
+        PersistState: true,
+        RepoSort:     sortByName,
+        Mouse:        true,
+        StatePath:    filepath.Join(home, ".cache", "cloudcurio", "tui_state.json"),
+        TemplatesDir: filepath.Join(home, ".config", "cloudcurio", "templates"),
+        Layout:       LayoutConfig{RepoRatio: 0.2, AIRatio: 0.25},
+        LogFile:      filepath.Join(home, ".cache", "cloudcurio", "tui.log"),
+        LogLevel:     "info",
+        RequiredDocs: []string{
+            "PROJECT_SUMMARY.md",
+            "RULES.md",
+            "AGENTS.md",
+            "INSTRUCTIONS.md",
+            "JOURNAL.md",
+            "SRS.md",
+            "TASKS.md",
+            "TESTING.md",
+        },
+        Docs: defaultDocs(),
+        AI: AIConfig{
+            OpenAI:     AIBackendConfig{Model: "gpt-4.1-mini"},
+            OpenRouter: AIBackendConfig{Model: "openrouter/auto"},
+            Gemini:     AIBackendConfig{Model: "gemini-1.5-flash"},
+        },
+        SSH: SSHConfig{
+            Addr:           ":23234",
+            HostKey:        filepath.Join(home, ".ssh", "cloudcurio_tui"),
+            AuthorizedKeys: filepath.Join(home, ".ssh", "cloudcurio_tui_authorized_keys"),
+            RootTemplate:   "/home/{user}/dev/cloudcurio",
+        },
+    }
+}
+
+// LoadConfig reads the YAML config file (CC_CONFIG or
+// ~/.config/cloudcurio/tui.yaml) over the built-in defaults and then
+// applies any environment variable overrides. A missing file is not an
+// error.
+func LoadConfig() (Config, error) {
+    home, err := os.UserHomeDir()
+    if err != nil {
+        return Config{}, fmt.Errorf("could not determine home directory: %w", err)
+    }
+
+    cfg := defaultConfig(home)
+
+    path := os.Getenv("CC_CONFIG")
+    if path == "" {
+        path = filepath.Join(home, ".config", "cloudcurio", "tui.yaml")
+    }
+
+    data, err := os.ReadFile(path)
+    switch {
+    case err == nil:
+        if err := yaml.Unmarshal(data, &cfg); err != nil {
+            return Config{}, fmt.Errorf("parse config %s: %w", path, err)
+        }
+    case !os.IsNotExist(err):
+        return Config{}, fmt.Errorf("read config %s: %w", path, err)
+    }
+
+    envOverride(&cfg.Root, "CC_ROOT")
+    envOverride(&cfg.Theme, "CC_THEME")
+    envOverride(&cfg.AI.OpenAI.APIKey, "OPENAI_API_KEY")
+    envOverride(&cfg.AI.OpenAI.Model, "OPENAI_MODEL")
+    envOverride(&cfg.AI.OpenRouter.APIKey, "OPENROUTER_API_KEY")
+    envOverride(&cfg.AI.OpenRouter.Model, "OPENROUTER_MODEL")
+    envOverride(&cfg.AI.Gemini.APIKey, "GEMINI_API_KEY")
+    envOverride(&cfg.AI.Gemini.Model, "GEMINI_MODEL")
+    for _, b := range []struct {
+        prefix string
+        cfg    *AIBackendConfig
+    }{
+        {"OPENAI", &cfg.AI.OpenAI},
+        {"OPENROUTER", &cfg.AI.OpenRouter},
+        {"GEMINI", &cfg.AI.Gemini},
+    } {
+        if err := envFloat(&b.cfg.Temperature, b.prefix+"_TEMPERATURE"); err != nil {
+            return Config{}, err
+        }
+        if err := envInt(&b.cfg.MaxTokens, b.prefix+"_MAX_TOKENS"); err != nil {
+            return Config{}, err
+        }
+    }
+    envOverride(&cfg.SSH.Addr, "CC_TUI_SSH_ADDR")
+    envOverride(&cfg.SSH.HostKey, "CC_TUI_SSH_KEY")
+    envOverride(&cfg.SSH.AuthorizedKeys, "CC_TUI_SSH_AUTHORIZED_KEYS")
+    envOverride(&cfg.SSH.RootTemplate, "CC_TUI_SSH_ROOT_TEMPLATE")
+    if v := os.Getenv("CC_TUI_SSH_SERVER"); v != "" {
+        cfg.SSH.Enabled = v == "1"
+    }
+    var maxSessions *int
+    if err := envInt(&maxSessions, "CC_TUI_SSH_MAX_SESSIONS"); err != nil {
+        return Config{}, err
+    }
+    if maxSessions != nil {
+        cfg.SSH.MaxSessions = *maxSessions
+    }
+    if cfg.SSH.MaxSessions < 0 {
+        return Config{}, fmt.Errorf("ssh.max_sessions: %d is negative", cfg.SSH.MaxSessions)
+    }
+    envOverride(&cfg.AI.Notify, "CC_AI_NOTIFY")
+    envOverride(&cfg.AI.SystemPrompt, "CC_AI_SYSTEM_PROMPT")
+    var rpm *int
+    if err := envInt(&rpm, "CC_AI_REQUESTS_PER_MINUTE"); err != nil {
+        return Config{}, err
+    }
+    if rpm != nil {
+        cfg.AI.RequestsPerMinute = *rpm
+    }
+    if cfg.AI.RequestsPerMinute < 0 {
+        return Config{}, fmt.Errorf("ai.requests_per_minute: %d is negative", cfg.AI.RequestsPerMinute)
+    }
+    envOverride(&cfg.LogFile, "CC_LOG_FILE")
+    envOverride(&cfg.LogLevel, "CC_LOG_LEVEL")
+
+    cfg.Root = expandHome(cfg.Root, home)
+    cfg.StatePath = expandHome(cfg.StatePath, home)
+    cfg.TemplatesDir = expandHome(cfg.TemplatesDir, home)
+    cfg.LogFile = expandHome(cfg.LogFile, home)
+    cfg.SSH.HostKey = expandHome(cfg.SSH.HostKey, home)
+    cfg.SSH.AuthorizedKeys = expandHome(cfg.SSH.AuthorizedKeys, home)
+    cfg.Theme = strings.ToLower(strings.TrimSpace(cfg.Theme))
+    cfg.RepoSort = strings.ToLower(strings.TrimSpace(cfg.RepoSort))
+    if cfg.RepoSort == "" {
+        cfg.RepoSort = sortByName
+    }
+    if !containsString(sortKeys, cfg.RepoSort) {
+        return Config{}, fmt.Errorf("repo_sort: %q is not one of %s", cfg.RepoSort, strings.Join(sortKeys, ", "))
+    }
+    if err := checkPaneRatios(cfg.Layout.RepoRatio, cfg.Layout.AIRatio); err != nil {
+        return Config{}, fmt.Errorf("layout: %w", err)
+    }
+    if err := checkDocs(cfg.Docs, cfg.Keys); err != nil {
+        return Config{}, err
+    }
+    cfg.AI.Notify = strings.ToLower(strings.TrimSpace(cfg.AI.Notify))
+    if !containsString(notifyModes, cfg.AI.Notify) {
+        return Config{}, fmt.Errorf("ai.notify: %q is not one of %s", cfg.AI.Notify, strings.Join(notifyModes[1:], ", "))
+    }
+    cfg.LogLevel = strings.ToLower(strings.TrimSpace(cfg.LogLevel))
+    if _, err := parseLogLevel(cfg.LogLevel); err != nil {
+        return Config{}, err
+    }
+
+    return cfg, nil
+}
+
+// envOverride replaces *dst with the value of the named env var when set.
+func envOverride(dst *string, name string) {
+    if v := os.Getenv(name); v != "" {
+        *dst = v
+    }
+}
+
+// envFloat sets *dst from the named env var when set.
+func envFloat(dst **float64, name string) error {
+    v := os.Getenv(name)
+    if v == "" {
+        return nil
+    }
+    f, err := strconv.ParseFloat(v, 64)
+    if err != nil {
+        return fmt.Errorf("%s: %q is not a number", name, v)
+    }
+    *dst = &f
+    return nil
+}
+
+// envInt sets *dst from the named env var when set.
+func envInt(dst **int, name string) error {
+    v := os.Getenv(name)
+    if v == "" {
+        return nil
+    }
+    n, err := strconv.Atoi(v)
+    if err != nil || n <= 0 {
+        return fmt.Errorf("%s: %q is not a positive integer", name, v)
+    }
+    *dst = &n
+    return nil
+}
+
+// expandHome expands a leading "~/" in path to the user's home directory.
+func expandHome(path, home string) string {
+    if path == "~" {
+        return home
+    }
+    if strings.HasPrefix(path, "~/") {
+        return filepath.Join(home, path[2:])
+    }
+    return path
+}
+
+// ---------------------------------------------------------------------
+// Logging
+// ---------------------------------------------------------------------
+
+// logLevels maps the accepted log_level / CC_LOG_LEVEL values to slog levels.
+var logLevels = map[string]slog.Level{
+    "debug": slog.LevelDebug,
+    "info":  slog.LevelInfo,
+    "warn":  slog.LevelWarn,
+    "error": slog.LevelError,
+}
+
+// parseLogLevel returns the slog level for name; empty means info.
+func parseLogLevel(name string) (slog.Level, error) {
+    if name == "" {
+        return slog.LevelInfo, nil
+    }
+    level, ok := logLevels[name]
+    if !ok {
+        return 0, fmt.Errorf("log_level: %q is not one of debug, info, warn, error", name)
+    }
+    return level, nil
+}
+
+// setupLogging points the default slog logger (and the standard log
+// package, which then writes through slog) at cfg.LogFile. In SSH mode records are
+// copied to stderr too, so the server console keeps showing connections.
+// The returned file should be closed on exit.
+func setupLogging(cfg Config) (*os.File, error) {
+    level, err := parseLogLevel(cfg.LogLevel)
+    if err != nil {
+        return nil, err
+    }
+    if err := os.MkdirAll(filepath.Dir(cfg.LogFile), 0o755); err != nil {
+        return nil, fmt.Errorf("create log directory: %w", err)
+    }
+    f, err := os.OpenFile(cfg.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+    if err != nil {
+        return nil, fmt.Errorf("open log file: %w", err)
+    }
+
+    var w io.Writer = f
+    if cfg.SSH.Enabled {
+        w = io.MultiWriter(f, os.Stderr)
+    }
+    slog.SetDefault(slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: level})))
+    return f, nil
+}
+
+// ---------------------------------------------------------------------
+// Key Bindings
+// ---------------------------------------------------------------------
+
+// Action names used in the "keys" section of the config file.
+const (
+    actionQuit             = "quit"
+    actionNextPane         = "next_pane"
+    actionToggleAI         = "toggle_ai"
+    actionValidate         = "validate"
+    actionCommand          = "command"
+    actionLayoutDefault    = "layout_default"
+    actionLayoutInfra      = "layout_infra"
+    actionLayoutAgents     = "layout_agents"
+    actionSelect           = "select"
+    actionEditDoc          = "edit_doc"
+    actionPickModel        = "pick_model"
+    actionSummarize        = "summarize"
+    actionToggleErrors     = "toggle_errors"
+    actionSubmitAI         = "submit_ai"
+    actionClearAI          = "clear_ai"
+    actionSplitFocus       = "split_focus"
+    actionSplitClose       = "split_close"
+    actionDocBack          = "doc_back"
+    actionDocForward       = "doc_forward"
+    actionTogglePin        = "toggle_pin"
+    actionPull             = "pull"
+    actionGrowPane         = "grow_pane"
+    actionShrinkPane       = "shrink_pane"
+)
+
+// defaultKeyBindings returns the built-in action -> keys bindings. The doc
+// shortcuts are added from the config's docs list by newKeyMap.
+func defaultKeyBindings() map[string][]string {
+    return map[string][]string{
+        actionQuit:             {"q", "ctrl+c"},
+        actionNextPane:         {"tab"},
+        actionToggleAI:         {"a"},
+        actionValidate:         {"v"},
+        actionCommand:          {":"},
+        actionLayoutDefault:    {"1"},
+        actionLayoutInfra:      {"2"},
+        actionLayoutAgents:     {"3"},
+        actionSelect:           {"enter"},
+        actionEditDoc:          {"e"},
+        actionPickModel:        {"m"},
+        actionSummarize:        {"S"},
+        actionToggleErrors:     {"x"},
+        // Terminals cannot report Ctrl+Enter, so the multi-line AI
+        // input submits on these instead.
+        actionSubmitAI: {"ctrl+s", "alt+enter"},
+        actionClearAI:  {"ctrl+l"},
+        actionSplitFocus:       {"w"},
+        actionSplitClose:       {"W"},
+        actionDocBack:          {"[", "alt+left"},
+        actionDocForward:       {"]", "alt+right"},
+        actionTogglePin:        {"p"},
+        actionPull:             {"P"},
+        actionGrowPane:         {"+", "="},
+        actionShrinkPane:       {"-"},
+    }
+}
+
+// keyMap resolves a key string (as reported by tea.KeyMsg.String) to an
+// action name.
+type keyMap map[string]string
+
+// newKeyMap merges user bindings over the defaults and the doc shortcuts
+// and inverts them into a key -> action lookup. Unknown action names are
+// logged and ignored.
+func newKeyMap(user map[string][]string, docs []DocShortcut) keyMap {
+    bindings := defaultKeyBindings()
+    for _, d := range docs {
+        bindings[d.action()] = nil
+        if d.Key != "" {
+            bindings[d.action()] = []string{d.Key}
+        }
+    }
+    for action, keys := range user {
+        if _, ok := bindings[action]; !ok {
+            slog.Warn("unknown key binding action", "action", action)
+            continue
+        }
+        bindings[action] = keys
+    }
+
+    km := keyMap{}
+    for action, keys := range bindings {
+        for _, k := range keys {
+            km[k] = action
+        }
+    }
+    return km
+}
+
+// keyFor returns the key to advertise for action: the shortest bound key,
+// ties broken alphabetically, or "" if the action is unbound.
+func (km keyMap) keyFor(action string) string {
+    best := ""
+    for k, a := range km {
+        if a != action {
+            continue
+        }
+        if best == "" || len(k) < len(best) || (len(k) == len(best) && k < best) {
+            best = k
+        }
+    }
+    return best
+}
+
+// docFor returns the doc shortcut whose action is action.
+func docFor(docs []DocShortcut, action string) (DocShortcut, bool) {
+    for _, d := range docs {
+        if d.action() == action {
+            return d, true
+        }
+    }
+    return DocShortcut{}, false
+}
+
+// checkDocs validates the docs config: every entry names a file, no two
+// entries share an alias or action name, and no doc key is taken by
+// another action (after the "keys" remapping in userKeys).
+func checkDocs(docs []DocShortcut, userKeys map[string][]string) error {
+    bound := map[string]string{}
+    for action, keys := range defaultKeyBindings() {
+        if k, ok := userKeys[action]; ok {
+            keys = k
+        }
+        for _, k := range keys {
+            bound[k] = action
+        }
+    }
+    names := map[string]int{}
+    for i, d := range docs {
+        if strings.TrimSpace(d.File) == "" {
+            return fmt.Errorf("docs[%d]: file is required", i)
+        }
+        if d.Key != "" {
+            if other, ok := bound[d.Key]; ok {
+                return fmt.Errorf("docs[%d]: key %q is already bound to %s", i, d.Key, other)
+            }
+            bound[d.Key] = d.action()
+        }
+        for _, n := range append([]string{d.action()}, d.Aliases...) {
+            n = strings.ToLower(n)
+            if j, ok := names[n]; ok && j != i {
+                return fmt.Errorf("docs[%d]: %q is also used by docs[%d]", i, n, j)
+            }
+            names[n] = i
+        }
+    }
+    return nil
+}
+
+// paneHint is one "keys: label" entry in the status line hint.
+type paneHint struct {
+    label string
+    // keys is shown as-is; otherwise the keys bound to actions are joined
+    // with "/".
+    keys    string
+    actions []string
+    // docs stands for the doc shortcut actions, in config order.
+    docs bool
+    // multiline and singleLine limit the hint to one kind of AI prompt box.
+    multiline  bool
+    singleLine bool
+    // split limits the hint to when the main pane is split.
+    split bool
+}
+
+// paneHints lists the key hints shown in the status line for each pane.
+var paneHints = map[pane][]paneHint{
+    paneRepos: {
+        {label: "move", keys: "↑/↓"},
+        {label: "filter", keys: "/"},
+        {label: "open", actions: []string{actionSelect}},
+        {label: "pin", actions: []string{actionTogglePin}},
+        {label: "pull", actions: []string{actionPull}},
+        {label: "docs", docs: true},
+        {label: "validate", actions: []string{actionValidate}},
+        {label: "layouts", actions: []string{actionLayoutDefault, actionLayoutInfra, actionLayoutAgents}},
+        {label: "toggle AI", actions: []string{actionToggleAI}},
+        {label: "resize", actions: []string{actionGrowPane, actionShrinkPane}},
+        {label: "pane", actions: []string{actionNextPane}},
+        {label: "command", actions: []string{actionCommand}},
+        {label: "quit", actions: []string{actionQuit}},
+    },
+    paneMain: {
+        {label: "scroll", keys: "↑/↓ pgup/pgdn"},
+        {label: "search", keys: ":grep"},
+        {label: "docs", docs: true},
+        {label: "edit", actions: []string{actionEditDoc}},
+        {label: "back/forward", actions: []string{actionDocBack, actionDocForward}},
+        {label: "resize", actions: []string{actionGrowPane, actionShrinkPane}},
+        {label: "other half", actions: []string{actionSplitFocus}, split: true},
+        {label: "unsplit", actions: []string{actionSplitClose}, split: true},
+        {label: "pane", actions: []string{actionNextPane}},
+        {label: "command", actions: []string{actionCommand}},
+        {label: "quit", actions: []string{actionQuit}},
+    },
+    paneAI: {
+        {label: "send", actions: []string{actionSubmitAI}, multiline: true},
+        {label: "send", keys: "enter", singleLine: true},
+        {label: "newline", keys: "enter", multiline: true},
+        {label: "history", keys: "↑/↓"},
+        {label: "clear", actions: []string{actionClearAI}},
+        {label: "pane", actions: []string{actionNextPane}},
+        {label: "quit", keys: "ctrl+c"},
+    },
+}
+
+// paneHintText renders the status line hints for the active pane.
+func (m model) paneHintText() string {
+    var parts []string
+    for _, h := range paneHints[m.activePane] {
+        if (h.multiline && m.cfg.AI.SingleLineInput) || (h.singleLine && !m.cfg.AI.SingleLineInput) || (h.split && !m.split) {
+            continue
+        }
+        keys := h.keys
+        actions := h.actions
+        if h.docs {
+            actions = nil
+            for _, d := range m.cfg.Docs {
+                actions = append(actions, d.action())
+            }
+        }
+        if keys == "" {
+            var bound []string
+            for _, a := range actions {
+                if k := m.keys.keyFor(a); k != "" {
+                    bound = append(bound, k)
+                }
+            }
+            keys = strings.Join(bound, "/")
+        }
+        if keys == "" {
+            continue // every action remapped away
+        }
+        parts = append(parts, keys+": "+h.label)
+    }
+    return strings.Join(parts, " | ")
+}
+
 // ---------------------------------------------------------------------
 // Model
 // ---------------------------------------------------------------------
@@ -134,25 +1134,135 @@ type model struct {
     width      int
     height     int
     ready      bool
+    cfg        Config
+    keys       keyMap
     ccRoot     string
     activePane pane
     showAIPane bool
+    sshSession bool
+
+    // termOut is the terminal the program draws on (stdout, or the SSH
+    // session), where AI notifications are written; termTmux wraps OSC
+    // sequences for tmux passthrough.
+    termOut  io.Writer
+    termTmux bool
+
+    // currentDocPath is the absolute path of the doc shown in mainView,
+    // and currentDocMod its mtime when loaded (for auto-reload).
+    currentDocPath string
+    currentDocMod  time.Time
+
+    // docHistory records docs opened with loadSelectedRepoFile, oldest
+    // first; docHistoryPos is the entry on screen (-1 before the first).
+    docHistory    []docVisit
+    docHistoryPos int
+
+    statusFlash string
+    flashID     int
 
     statusMsg   string
     statusError string
 
+    // lastError is the full text of the most recent error, shown in the
+    // error pane (errView) since statusError is a single truncated line.
+    lastError     string
+    lastErrorAt   time.Time
+    showingErrors bool
+    errView       viewport.Model
+
+    // aiLabel names the backend/model AI calls go to, for the status bar.
+    aiLabel string
+
     repos    list.Model
     allRepos []list.Item
+    // pinned holds the names of repos listed first; see togglePin.
+    pinned map[string]bool
+    // sortKey orders allRepos (see sortRepos); repoSizes caches the
+    // recursive size of each repo path once sorting by size needs it.
+    sortKey     string
+    repoSizes   map[string]int64
+    sizingRepos bool
+
+    // pullRunning is set while a git pull runs. Its output goes to pullLog
+    // and, while pullInMain is set, to the main pane; loading a doc or a
+    // diff there clears pullInMain.
+    pullRunning bool
+    pullLog     []string
+    pullInMain  bool
+
+    // reposLoaded is set once the background CC_ROOT scan has returned;
+    // until then repos shows a placeholder. scanErr is the scan's error,
+    // used to explain an empty list.
+    reposLoaded bool
+    scanErr     error
 
     mainView viewport.Model
     aiView   viewport.Model
-    aiInput  textinput.Model
+
+    // :split shows splitView (splitDocPath) beside or below mainView.
+    // splitFocus routes scrolling to splitView; splitSideBySide is chosen
+    // by resizePanes from the main pane width.
+    split           bool
+    splitView       viewport.Model
+    splitDocPath    string
+    splitDocMod     time.Time
+    splitFocus      bool
+    splitSideBySide bool
+
+    // aiLog is the AI conversation shown in aiView; when empty, aiView
+    // shows the aiEmptyText placeholder instead.
+    aiLog string
+
+    // chatRepo is the path of the repo whose chat log is shown in aiView
+    // ("" until one is loaded). chatPending is the repo the request in
+    // flight was sent for, so its reply is logged there even if the
+    // selection has moved on. chatTurns are chatRepo's turns, the
+    // conversation sent along with each question (see chatHistory).
+    chatRepo    string
+    chatPending string
+    chatTurns   []chatTurn
+
+    // The AI prompt box: aiArea (multi-line) unless cfg.AI.SingleLineInput
+    // selects aiInput. See aiPrompt and resetAIPrompt.
+    aiInput textinput.Model
+    aiArea  textarea.Model
+
+    // aiHistory holds this session's submitted prompts, oldest first.
+    // aiHistoryPos is the entry shown in the prompt box, len(aiHistory)
+    // meaning the unsent draft, which is kept in aiDraft while browsing.
+    aiHistory    []string
+    aiHistoryPos int
+    aiDraft      string
 
     // Command palette
     commandMode  bool
     commandInput textinput.Model
 
-    mdRenderer *glamour.TermRenderer
+    // AI model picker. Fetched models are cached for the session in
+    // fetchedModels; manualModels holds config and :model entries.
+    pickingModel  bool
+    modelPicker   list.Model
+    fetchedModels []modelItem
+    modelsFetched bool
+    modelsLoading bool
+    manualModels  []string
+
+    // confirm is the destructive action awaiting y/n in the confirmation
+    // overlay; while set it takes every key. See askConfirm.
+    confirm *confirmAction
+
+    // :grep results, shown in the main pane while showingGrep is set.
+    showingGrep bool
+    grepList    list.Model
+    grepRunning bool
+
+    mdRenderer  *glamour.TermRenderer
+    mdWrapWidth int
+    mdCache     *renderCache
+    // wordCounts caches docWords results; like mdCache it is shared by
+    // model copies.
+    wordCounts map[string]wordCount
+    theme       string
 
     // Styles
     repoStyle   lipgloss.Style
@@ -163,11 +1273,22 @@ type model struct {
 
     // Flags
     aiLoading  bool
+    aiStarted  time.Time
+    aiSpinner  spinner.Model
     validating bool
 
     // Layout
     profile layoutProfile
 
+    // Rendered pane widths, used to map mouse clicks to panes.
+    repoPaneWidth int
+    mainPaneWidth int
+
+    // repoRatio and aiRatio start from cfg.Layout; +/- nudge them and
+    // they are saved in the state file when they differ from the config.
+    repoRatio float64
+    aiRatio   float64
+
     // Required docs for validation
     requiredDocs []string
 }
@@ -176,9 +1297,11 @@ type model struct {
 // Initialization
 // ---------------------------------------------------------------------
 
-func initialModel(ccRoot string) model {
-    items := scanRepos(ccRoot)
+func initialModel(cfg Config) model {
+    ccRoot := cfg.Root
 
+    // Init scans CC_ROOT off the UI goroutine; see reposLoadedMsg.
+    items := []list.Item{placeholderItem("Scanning " + ccRoot + "…")}
     repoList := list.New(items, list.NewDefaultDelegate(), 0, 0)
     repoList.SetFilteringEnabled(true)
     repoList.Title = "Repositories"
@@ -187,119 +1310,733 @@ func initialModel(ccRoot string) model {
     mainVP.SetContent("Select a repo and press Enter or 's' to load PROJECT_SUMMARY.md")
 
     aiVP := viewport.New(0, 0)
-    aiVP.SetContent("AI Chat Pane
+    aiVP.SetContent(aiEmptyText(cfg.AI))
 
-Type in the input below and press Enter.
-Configure OPENAI_API_KEY or OPENROUTER_API_KEY to enable real responses.")
+    aiSpin := spinner.New()
+    aiSpin.Spinner = spinner.Dot
 
     aiInput := textinput.New()
     aiInput.Placeholder = "Ask an AI agent something about your project…"
     aiInput.CharLimit = 500
     aiInput.Prompt = "> "
 
+    aiArea := textarea.New()
+    aiArea.Placeholder = "Ask an AI agent something about your project… (ctrl+s to send)"
+    aiArea.CharLimit = 8000
+    aiArea.ShowLineNumbers = false
+    aiArea.Prompt = "> "
+    aiArea.SetHeight(aiAreaHeight)
+
+    picker := list.New(nil, list.NewDefaultDelegate(), 0, 0)
+    picker.Title = "AI Models"
+    picker.SetFilteringEnabled(true)
+    picker.KeyMap.Quit.SetEnabled(false)
+
+    grepList := list.New(nil, list.NewDefaultDelegate(), 0, 0)
+    grepList.Title = "Search results"
+    grepList.SetFilteringEnabled(true)
+    grepList.KeyMap.Quit.SetEnabled(false)
+
     cmdInput := textinput.New()
     cmdInput.Placeholder = "Command (validate, open RULES, layout infra)..."
     cmdInput.CharLimit = 200
     cmdInput.Prompt = ": "
 
-    mdRend, err := glamour.NewTermRenderer(
-        glamour.WithAutoStyle(),
-        glamour.WithWordWrap(80),
-    )
-    if err != nil {
-        mdRend = nil
-    }
+    theme := cfg.Theme
+    mdRend := newMarkdownRenderer(80, theme)
+    palette := paletteForTheme(theme)
 
     repoStyle := lipgloss.NewStyle().
         Border(lipgloss.RoundedBorder()).
-        BorderForeground(lipgloss.Color("63")).
+        BorderForeground(palette.repoBorder).
         Padding(0, 1)
 
     mainStyle := lipgloss.NewStyle().
         Border(lipgloss.RoundedBorder()).
-        BorderForeground(lipgloss.Color("39")).
+        BorderForeground(palette.mainBorder).
         Padding(0, 1)
 
     aiStyle := lipgloss.NewStyle().
         Border(lipgloss.RoundedBorder()).
-        BorderForeground(lipgloss.Color("205")).
+        BorderForeground(palette.aiBorder).
         Padding(0, 1)
 
     statusStyle := lipgloss.NewStyle().
-        Foreground(lipgloss.Color("241")).
+        Foreground(palette.status).
         PaddingLeft(1)
 
     errorStyle := lipgloss.NewStyle().
-        Foreground(lipgloss.Color("196")).
+        Foreground(palette.error).
         Bold(true).
         PaddingLeft(1)
 
-    required := []string{
-        "PROJECT_SUMMARY.md",
-        "RULES.md",
-        "AGENTS.md",
-        "INSTRUCTIONS.md",
-        "JOURNAL.md",
-        "SRS.md",
-        "TASKS.md",
-        "TESTING.md",
-    }
-
-    return model{
+    m := model{
+        cfg:           cfg,
+        keys:          newKeyMap(cfg.Keys, cfg.Docs),
         ccRoot:        ccRoot,
+        termOut:       os.Stdout,
+        termTmux:      os.Getenv("TMUX") != "",
         activePane:    paneRepos,
         showAIPane:    true,
         statusMsg:     fmt.Sprintf("CC_ROOT: %s", ccRoot),
         repos:         repoList,
-        allRepos:      items,
         mainView:      mainVP,
+        splitView:     viewport.New(0, 0),
+        docHistoryPos: -1,
         aiView:        aiVP,
         aiInput:       aiInput,
+        aiArea:        aiArea,
         commandMode:   false,
         commandInput:  cmdInput,
+        modelPicker:   picker,
+        grepList:      grepList,
+        manualModels:  append([]string(nil), cfg.AI.Models...),
+        aiLabel:       cfg.AI.label(),
+        errView:       viewport.New(0, 0),
         mdRenderer:    mdRend,
+        mdWrapWidth:   80,
+        mdCache:       newRenderCache(),
+        wordCounts:    map[string]wordCount{},
+        theme:         theme,
         repoStyle:     repoStyle,
         mainStyle:     mainStyle,
         aiStyle:       aiStyle,
         statusStyle:   statusStyle,
         errorStyle:    errorStyle,
         aiLoading:     false,
+        aiSpinner:     aiSpin,
         validating:    false,
         profile:       profileDefault,
-        requiredDocs:  required,
+        requiredDocs:  cfg.RequiredDocs,
+        sortKey:       cfg.RepoSort,
+        repoSizes:     map[string]int64{},
+        repoRatio:     cfg.Layout.RepoRatio,
+        aiRatio:       cfg.Layout.AIRatio,
     }
+    return m
 }
 
-// scanRepos looks for directories in ccRoot and creates repo list items.
-func scanRepos(ccRoot string) []list.Item {
-    entries, err := os.ReadDir(ccRoot)
+// uiState is the small bit of UI state persisted between runs.
+type uiState struct {
+    Repo      string   `json:"repo"`
+    Doc       string   `json:"doc,omitempty"`
+    Pinned    []string `json:"pinned,omitempty"`
+    RepoRatio float64  `json:"repo_ratio,omitempty"`
+    AIRatio   float64  `json:"ai_ratio,omitempty"`
+}
+
+// restoreState reselects the repo and doc saved by the previous run and
+// restores the pinned repos and pane ratios. A missing or stale state
+// file leaves the default selection in place.
+func (m model) restoreState() model {
+    data, err := os.ReadFile(m.cfg.StatePath)
     if err != nil {
-        log.Printf("[cloudcurio-tui] warning: unable to read CC_ROOT (%s): %v", ccRoot, err)
-        return []list.Item{}
+        return m
     }
 
-    var items []list.Item
-    for _, e := range entries {
-        if !e.IsDir() {
-            continue
-        }
-        name := e.Name()
-        path := filepath.Join(ccRoot, name)
-        items = append(items, repoItem{name: name, path: path})
+    var st uiState
+    if err := json.Unmarshal(data, &st); err != nil {
+        slog.Warn("ignoring unreadable state file", "path", m.cfg.StatePath, "err", err)
+        return m
     }
-    return items
-}
 
-// ---------------------------------------------------------------------
-// Bubble Tea Implementation
-// ---------------------------------------------------------------------
+    if st.RepoRatio > 0 && st.AIRatio > 0 && checkPaneRatios(st.RepoRatio, st.AIRatio) == nil {
+        m.repoRatio, m.aiRatio = st.RepoRatio, st.AIRatio
+        m = m.resizePanes()
+    }
 
-func (m model) Init() tea.Cmd {
-    return nil
+    if len(st.Pinned) > 0 {
+        m.pinned = make(map[string]bool, len(st.Pinned))
+        for _, name := range st.Pinned {
+            m.pinned[name] = true
+        }
+        m = m.applyProfileFilter()
+    }
+
+    for i, it := range m.repos.Items() {
+        if r, ok := it.(repoItem); ok && r.name == st.Repo {
+            m.repos.Select(i)
+            if st.Doc != "" {
+                m = m.loadSelectedRepoFile(st.Doc)
+            }
+            return m
+        }
+    }
+    return m
 }
 
-func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
-    var cmds []tea.Cmd
+// saveState writes the selected repo and loaded doc to the state file.
+func (m model) saveState() {
+    if !m.cfg.PersistState {
+        return
+    }
+
+    item, ok := m.repos.SelectedItem().(repoItem)
+    if !ok {
+        return
+    }
+    st := uiState{Repo: item.name}
+    if m.currentDocPath != "" && filepath.Dir(m.currentDocPath) == item.path {
+        st.Doc = filepath.Base(m.currentDocPath)
+    }
+    for name := range m.pinned {
+        st.Pinned = append(st.Pinned, name)
+    }
+    sort.Strings(st.Pinned)
+    if m.repoRatio != m.cfg.Layout.RepoRatio || m.aiRatio != m.cfg.Layout.AIRatio {
+        st.RepoRatio, st.AIRatio = m.repoRatio, m.aiRatio
+    }
+
+    data, err := json.MarshalIndent(st, "", "  ")
+    if err != nil {
+        return
+    }
+    if err := os.MkdirAll(filepath.Dir(m.cfg.StatePath), 0o755); err != nil {
+        slog.Warn("cannot save state", "err", err)
+        return
+    }
+    if err := os.WriteFile(m.cfg.StatePath, data, 0o644); err != nil {
+        slog.Warn("cannot save state", "err", err)
+    }
+}
+
+// themePalette holds the lipgloss colors used for pane borders and the
+// status line.
+type themePalette struct {
+    repoBorder lipgloss.TerminalColor
+    mainBorder lipgloss.TerminalColor
+    aiBorder   lipgloss.TerminalColor
+    status     lipgloss.TerminalColor
+    error      lipgloss.TerminalColor
+}
+
+// paletteForTheme maps a CC_THEME value to colors. Unknown values use
+// adaptive colors that follow the terminal background.
+func paletteForTheme(theme string) themePalette {
+    dark := themePalette{
+        repoBorder: lipgloss.Color("63"),
+        mainBorder: lipgloss.Color("39"),
+        aiBorder:   lipgloss.Color("205"),
+        status:     lipgloss.Color("241"),
+        error:      lipgloss.Color("196"),
+    }
+    light := themePalette{
+        repoBorder: lipgloss.Color("57"),
+        mainBorder: lipgloss.Color("25"),
+        aiBorder:   lipgloss.Color("162"),
+        status:     lipgloss.Color("237"),
+        error:      lipgloss.Color("160"),
+    }
+
+    switch theme {
+    case "dark":
+        return dark
+    case "light":
+        return light
+    default:
+        return themePalette{
+            repoBorder: lipgloss.AdaptiveColor{Light: "57", Dark: "63"},
+            mainBorder: lipgloss.AdaptiveColor{Light: "25", Dark: "39"},
+            aiBorder:   lipgloss.AdaptiveColor{Light: "162", Dark: "205"},
+            status:     lipgloss.AdaptiveColor{Light: "237", Dark: "241"},
+            error:      lipgloss.AdaptiveColor{Light: "160", Dark: "196"},
+        }
+    }
+}
+
+// glamourStyleOption maps a CC_THEME value to a glamour style option.
+func glamourStyleOption(theme string) glamour.TermRendererOption {
+    switch theme {
+    case "dark", "light":
+        return glamour.WithStandardStyle(theme)
+    default:
+        return glamour.WithAutoStyle()
+    }
+}
+
+// newMarkdownRenderer builds a glamour renderer for the given theme that
+// wraps at the given width. It returns nil if the renderer cannot be
+// created, in which case docs are shown as plain text.
+func newMarkdownRenderer(wrap int, theme string) *glamour.TermRenderer {
+    r, err := glamour.NewTermRenderer(
+        glamourStyleOption(theme),
+        glamour.WithWordWrap(wrap),
+    )
+    if err != nil {
+        return nil
+    }
+    return r
+}
+
+// Bounds for renderCache. Entries are evicted least-recently-used first
+// once either limit is exceeded.
+const (
+    renderCacheMaxEntries = 32
+    renderCacheMaxBytes   = 16 << 20
+)
+
+// renderKey identifies one rendering of a doc. A changed mtime or wrap
+// width yields a different key, so stale renders are never served.
+type renderKey struct {
+    path    string
+    modTime time.Time
+    wrap    int
+}
+
+// renderCache is a small LRU of glamour output, shared by model copies.
+type renderCache struct {
+    entries map[renderKey]string
+    order   []renderKey // least recently used first
+    bytes   int
+}
+
+func newRenderCache() *renderCache {
+    return &renderCache{entries: map[renderKey]string{}}
+}
+
+// get returns the cached render for key and marks it recently used.
+func (c *renderCache) get(key renderKey) (string, bool) {
+    s, ok := c.entries[key]
+    if ok {
+        c.touch(key)
+    }
+    return s, ok
+}
+
+// put stores a render, dropping older renders of the same path (they are
+// stale by definition) and evicting until the cache is within bounds.
+func (c *renderCache) put(key renderKey, rendered string) {
+    for k := range c.entries {
+        if k.path == key.path {
+            c.remove(k)
+        }
+    }
+    c.entries[key] = rendered
+    c.order = append(c.order, key)
+    c.bytes += len(rendered)
+
+    for len(c.order) > 1 && (len(c.order) > renderCacheMaxEntries || c.bytes > renderCacheMaxBytes) {
+        c.remove(c.order[0])
+    }
+}
+
+func (c *renderCache) touch(key renderKey) {
+    for i, k := range c.order {
+        if k == key {
+            c.order = append(append(c.order[:i:i], c.order[i+1:]...), key)
+            return
+        }
+    }
+}
+
+func (c *renderCache) remove(key renderKey) {
+    c.bytes -= len(c.entries[key])
+    delete(c.entries, key)
+    for i, k := range c.order {
+        if k == key {
+            c.order = append(c.order[:i], c.order[i+1:]...)
+            return
+        }
+    }
+}
+
+// scanReposCmd scans ccRoot in the background.
+func scanReposCmd(ccRoot string, rescan bool) tea.Cmd {
+    return func() tea.Msg {
+        items, err := scanRepos(ccRoot)
+        return reposLoadedMsg{items: items, err: err, rescan: rescan}
+    }
+}
+
+// scanRepos looks for directories in ccRoot and creates repo list items.
+func scanRepos(ccRoot string) ([]list.Item, error) {
+    entries, err := os.ReadDir(ccRoot)
+    if err != nil {
+        slog.Error("unable to read CC_ROOT", "root", ccRoot, "err", err)
+        return []list.Item{}, err
+    }
+
+    var items []list.Item
+    for _, e := range entries {
+        if !e.IsDir() {
+            continue
+        }
+        name := e.Name()
+        path := filepath.Join(ccRoot, name)
+        items = append(items, repoItem{name: name, path: path})
+    }
+    slog.Info("scanned CC_ROOT", "root", ccRoot, "repos", len(items))
+    return items, nil
+}
+
+// emptyRepoItems explains an empty repo list: CC_ROOT missing, unreadable,
+// or holding no repo directories, followed by a hint on how to fix it.
+func emptyRepoItems(ccRoot string, err error) []list.Item {
+    var reason placeholderItem
+    switch {
+    case errors.Is(err, os.ErrNotExist):
+        reason = placeholderItem("CC_ROOT not found: " + ccRoot)
+    case err != nil:
+        reason = placeholderItem("Cannot read CC_ROOT: " + err.Error())
+    default:
+        reason = placeholderItem("No repos found in " + ccRoot)
+    }
+    return []list.Item{
+        reason,
+        placeholderItem("Set CC_ROOT (or root: in the config) or run :refresh"),
+    }
+}
+
+// refreshRepos rescans CC_ROOT in the background, showing the scanning
+// placeholder until the result arrives.
+func (m model) refreshRepos() (model, tea.Cmd) {
+    m.reposLoaded = false
+    m.scanErr = nil
+    m.repos.SetItems([]list.Item{placeholderItem("Scanning " + m.ccRoot + "…")})
+    m.statusMsg = "Rescanning " + m.ccRoot
+    m.statusError = ""
+    return m, scanReposCmd(m.ccRoot, true)
+}
+
+// gitState is the git metadata shown next to a repo in the list.
+type gitState struct {
+    branch string // empty when the directory is not a git work tree
+    dirty  bool
+    ahead  int
+    behind int
+}
+
+// String formats the state compactly, e.g. "main* ↑2".
+func (g gitState) String() string {
+    s := g.branch
+    if g.dirty {
+        s += "*"
+    }
+    if g.ahead > 0 {
+        s += fmt.Sprintf(" ↑%d", g.ahead)
+    }
+    if g.behind > 0 {
+        s += fmt.Sprintf(" ↓%d", g.behind)
+    }
+    return s
+}
+
+// gitWorkers bounds concurrent git state lookups.
+const gitWorkers = 8
+
+// gitAheadBehind matches the "[ahead 1, behind 2]" suffix of a branch line.
+var gitAheadBehind = regexp.MustCompile(`\[(?:ahead (\d+))?(?:, )?(?:behind (\d+))?\]$`)
+
+// lookupGitState reads the branch, dirty flag and upstream divergence of
+// the work tree at path. Directories without .git, and any git failure,
+// yield the zero state so the repo simply shows no git info.
+func lookupGitState(path string) gitState {
+    if _, err := os.Stat(filepath.Join(path, ".git")); err != nil {
+        return gitState{}
+    }
+    out, err := exec.Command("git", "-C", path, "status", "--porcelain=v1", "--branch").Output()
+    if err != nil {
+        return gitState{}
+    }
+
+    var st gitState
+    lines := strings.Split(strings.TrimRight(string(out), "\n"), "\n")
+    // The first line is "## <branch>[...<upstream>][ [ahead N, behind M]]".
+    if head, ok := strings.CutPrefix(lines[0], "## "); ok {
+        branch := head
+        if i := strings.Index(branch, "..."); i >= 0 {
+            branch = branch[:i]
+        } else if i := strings.Index(branch, " ["); i >= 0 {
+            branch = branch[:i]
+        }
+        st.branch = strings.TrimPrefix(branch, "No commits yet on ")
+        if mm := gitAheadBehind.FindStringSubmatch(head); mm != nil {
+            st.ahead, _ = strconv.Atoi(mm[1])
+            st.behind, _ = strconv.Atoi(mm[2])
+        }
+        lines = lines[1:]
+    }
+    st.dirty = len(lines) > 0
+    return st
+}
+
+// gitLookupCmd looks up the git state of repos on a bounded pool of
+// workers and streams the results back one gitStateMsg at a time, so the
+// list fills in incrementally instead of waiting for the slowest repo.
+func gitLookupCmd(repos []repoItem) tea.Cmd {
+    if len(repos) == 0 {
+        return nil
+    }
+    jobs := make(chan repoItem)
+    results := make(chan gitStateMsg)
+
+    workers := gitWorkers
+    if workers > len(repos) {
+        workers = len(repos)
+    }
+    var wg sync.WaitGroup
+    for i := 0; i < workers; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for repo := range jobs {
+                results <- gitStateMsg{path: repo.path, state: lookupGitState(repo.path)}
+            }
+        }()
+    }
+    go func() {
+        for _, repo := range repos {
+            jobs <- repo
+        }
+        close(jobs)
+        wg.Wait()
+        close(results)
+    }()
+
+    var next tea.Cmd
+    next = func() tea.Msg {
+        msg, ok := <-results
+        if !ok {
+            return nil
+        }
+        msg.next = next
+        return msg
+    }
+    return next
+}
+
+// repoItems returns the repoItems among items.
+func repoItems(items []list.Item) []repoItem {
+    var repos []repoItem
+    for _, it := range items {
+        if r, ok := it.(repoItem); ok {
+            repos = append(repos, r)
+        }
+    }
+    return repos
+}
+
+// setGitState records the git state of the repo at path in allRepos and
+// in the visible list. allRepos is copied first because the list may
+// share its backing array.
+func (m model) setGitState(path string, st gitState) (model, tea.Cmd) {
+    all := make([]list.Item, len(m.allRepos))
+    for i, it := range m.allRepos {
+        if r, ok := it.(repoItem); ok && r.path == path {
+            r.git = &st
+            it = r
+        }
+        all[i] = it
+    }
+    m.allRepos = all
+
+    var cmd tea.Cmd
+    for i, it := range m.repos.Items() {
+        if r, ok := it.(repoItem); ok && r.path == path {
+            r.git = &st
+            cmd = m.repos.SetItem(i, r)
+            break
+        }
+    }
+    return m, cmd
+}
+
+// carryGitState copies already looked-up git state from old into fresh
+// scan results, matching repos by path.
+func carryGitState(old, fresh []list.Item) []list.Item {
+    known := make(map[string]*gitState)
+    for _, it := range old {
+        if r, ok := it.(repoItem); ok && r.git != nil {
+            known[r.path] = r.git
+        }
+    }
+    for i, it := range fresh {
+        if r, ok := it.(repoItem); ok {
+            r.git = known[r.path]
+            fresh[i] = r
+        }
+    }
+    return fresh
+}
+
+// pullTimeout bounds a git pull, so an unreachable remote cannot leave it
+// running forever.
+const pullTimeout = 2 * time.Minute
+
+// startPull handles P and ":pull": it runs git pull --ff-only in the
+// selected repo and shows the output in the main pane as it arrives.
+func (m model) startPull() (model, tea.Cmd) {
+    item, ok := m.repos.SelectedItem().(repoItem)
+    if !ok {
+        m.statusError = "No repo selected"
+        return m, nil
+    }
+    if m.pullRunning {
+        m.statusError = "A pull is already running"
+        return m, nil
+    }
+    if _, err := os.Stat(filepath.Join(item.path, ".git")); err != nil {
+        m.statusError = item.name + " is not a git repository"
+        return m, nil
+    }
+    return m.askConfirm("Run git pull --ff-only in "+item.name+"?", func(m model) (model, tea.Cmd) {
+        return m.runPull(item)
+    }), nil
+}
+
+// runPull starts the confirmed pull of item, showing its output in the
+// main pane.
+func (m model) runPull(item repoItem) (model, tea.Cmd) {
+    if m.pullRunning {
+        m.statusError = "A pull is already running"
+        return m, nil
+    }
+    m.pullRunning = true
+    m.pullLog = []string{"$ git -C " + item.path + " pull --ff-only", ""}
+    m.pullInMain = true
+    m.currentDocPath = ""
+    m = m.showPullLog()
+    m.statusMsg = "Pulling " + item.name + "..."
+    m.statusError = ""
+    return m, pullCmd(item)
+}
+
+// pullCmd runs git pull --ff-only in repo, delivering each output line as
+// a pullOutputMsg and finishing with a pullDoneMsg. Prompts for
+// credentials are disabled so the pull fails instead of waiting for input
+// the TUI cannot give.
+func pullCmd(repo repoItem) tea.Cmd {
+    msgs := make(chan tea.Msg)
+    go func() {
+        defer close(msgs)
+
+        ctx, cancel := context.WithTimeout(context.Background(), pullTimeout)
+        defer cancel()
+        cmd := exec.CommandContext(ctx, "git", "-C", repo.path, "pull", "--ff-only")
+        cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+        if os.Getenv("GIT_SSH_COMMAND") == "" {
+            cmd.Env = append(cmd.Env, "GIT_SSH_COMMAND=ssh -o BatchMode=yes")
+        }
+        pr, pw := io.Pipe()
+        cmd.Stdout = pw
+        cmd.Stderr = pw
+
+        if err := cmd.Start(); err != nil {
+            msgs <- pullDoneMsg{repo: repo, err: err}
+            return
+        }
+        waitErr := make(chan error, 1)
+        go func() {
+            err := cmd.Wait()
+            pw.Close()
+            waitErr <- err
+        }()
+
+        var out strings.Builder
+        sc := bufio.NewScanner(pr)
+        for sc.Scan() {
+            out.WriteString(sc.Text() + "\n")
+            msgs <- pullOutputMsg{line: sc.Text()}
+        }
+        err := <-waitErr
+        if ctx.Err() == context.DeadlineExceeded {
+            err = fmt.Errorf("timed out after %s", pullTimeout)
+        }
+        msgs <- pullDoneMsg{repo: repo, output: out.String(), err: err}
+    }()
+
+    var next tea.Cmd
+    next = func() tea.Msg {
+        msg, ok := <-msgs
+        if !ok {
+            return nil
+        }
+        if line, ok := msg.(pullOutputMsg); ok {
+            line.next = next
+            return line
+        }
+        return msg
+    }
+    return next
+}
+
+// showPullLog puts the pull output in the main pane, following its end,
+// unless a doc has been opened there since the pull started.
+func (m model) showPullLog() model {
+    if !m.pullInMain {
+        return m
+    }
+    m.mainView.SetContent(wrapText(strings.Join(m.pullLog, "\n"), m.mainView.Width))
+    m.mainView.GotoBottom()
+    return m
+}
+
+// finishPull reports the outcome of a pull. git's usual refusals get a
+// plain explanation; anything else goes to the error pane with git's
+// output.
+func (m model) finishPull(msg pullDoneMsg) model {
+    name := msg.repo.name
+    if msg.err == nil {
+        m.pullLog = append(m.pullLog, "", "Done.")
+        m = m.showPullLog()
+        m.statusMsg = "Pulled " + name
+        if strings.Contains(msg.output, "Already up to date") {
+            m.statusMsg = name + " is already up to date"
+        }
+        return m
+    }
+
+    m.pullLog = append(m.pullLog, "", "Failed: "+msg.err.Error())
+    m = m.showPullLog()
+    m.statusMsg = ""
+    switch out := msg.output; {
+    case strings.Contains(out, "Not possible to fast-forward"), strings.Contains(out, "diverg"):
+        m.statusError = name + " has diverged from its upstream; merge or rebase in a shell"
+    case strings.Contains(out, "would be overwritten"):
+        m.statusError = "Local changes in " + name + " would be overwritten; commit or stash them first"
+    case strings.Contains(out, "CONFLICT"), strings.Contains(out, "unmerged"):
+        m.statusError = name + " has unresolved merge conflicts; resolve them in a shell"
+    case strings.Contains(out, "no tracking information"):
+        m.statusError = name + " has no upstream branch to pull from"
+    default:
+        err := msg.err
+        if out = strings.TrimSpace(out); out != "" {
+            err = fmt.Errorf("%v\n%s", msg.err, out)
+        }
+        m.setError("git pull "+name, err)
+    }
+    return m
+}
+
+// ---------------------------------------------------------------------
+// Bubble Tea Implementation
+// ---------------------------------------------------------------------
+
+// docCheckInterval is how often the displayed doc is checked for changes.
+const docCheckInterval = time.Second
+
+func (m model) Init() tea.Cmd {
+    return tea.Batch(docCheckCmd(), scanReposCmd(m.ccRoot, false))
+}
+
+// docCheckCmd schedules the next displayed-doc change check. Polling the
+// one visible file keeps this cheap and avoids per-file watch handles;
+// whichever doc is current at tick time is the one checked, so opening a
+// new doc implicitly stops watching the old one.
+func docCheckCmd() tea.Cmd {
+    return tea.Tick(docCheckInterval, func(time.Time) tea.Msg { return docCheckMsg{} })
+}
+
+// flash shows a transient note in the status line for a couple of seconds.
+func (m model) flash(note string) (model, tea.Cmd) {
+    m.flashID++
+    m.statusFlash = note
+    id := m.flashID
+    return m, tea.Tick(2*time.Second, func(time.Time) tea.Msg { return flashExpiredMsg{id: id} })
+}
+
+func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+    var cmds []tea.Cmd
 
     switch msg := msg.(type) {
     case tea.WindowSizeMsg:
@@ -309,15 +2046,173 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
         m = m.resizePanes()
         return m, nil
 
+    case spinner.TickMsg:
+        // Let the spinner stop by not scheduling further ticks once idle.
+        if !m.aiLoading {
+            return m, nil
+        }
+        var cmd tea.Cmd
+        m.aiSpinner, cmd = m.aiSpinner.Update(msg)
+        return m, cmd
+
     case aiResponseMsg:
         m.aiLoading = false
+        m.aiStarted = time.Time{}
+        repo := m.chatPending
+        m.chatPending = ""
+        note := "AI response ready"
         if msg.err != nil {
-            m.statusError = fmt.Sprintf("AI error: %v", msg.err)
-            m.appendAI("[error] " + msg.err.Error())
+            m.setError("AI error", msg.err)
+            m.recordAI(repo, "error", msg.err.Error())
+            note = "AI request failed"
         } else {
             m.statusError = ""
-            m.appendAI("AI: " + msg.response)
+            m.recordAI(repo, "assistant", msg.response)
+        }
+        if repo != m.chatRepo {
+            m.statusMsg = note + " (saved to " + filepath.Base(repo) + "'s chat)"
+        }
+        return m, notifyCmd(m.termOut, m.cfg.AI.Notify, m.termTmux, "cloudcurio: "+note)
+
+    case tea.MouseMsg:
+        if m.confirm != nil {
+            return m, nil
+        }
+        // Wheel events fall through to the focused pane below.
+        if msg.Action == tea.MouseActionPress && msg.Button == tea.MouseButtonLeft {
+            return m.handleClick(msg.X, msg.Y)
+        }
+
+    case modelsLoadedMsg:
+        m.modelsLoading = false
+        if msg.err != nil {
+            // Leave modelsFetched unset so reopening the picker retries.
+            m.setError(fmt.Sprintf("Could not list %s models", msg.backend), msg.err)
+            return m, nil
+        }
+        m.fetchedModels = msg.models
+        m.modelsFetched = true
+        m = m.refreshModelPicker()
+        m.statusMsg = fmt.Sprintf("Loaded %d %s models", len(msg.models), msg.backend)
+        return m, nil
+
+    case scaffoldDraftMsg:
+        m.aiLoading = false
+        m.aiStarted = time.Time{}
+        if msg.err != nil {
+            m.setError("AI error", msg.err)
+            m.appendAI("[error] " + msg.err.Error())
+            return m, nil
+        }
+        m.appendAI(fmt.Sprintf("AI draft of %s:\n%s", filepath.Base(msg.path), msg.draft))
+        path, draft := msg.path, msg.draft
+        m = m.askConfirm("Write the draft to "+path+"?", func(m model) (model, tea.Cmd) {
+            return m.writeScaffold(path, draft), nil
+        })
+        m.confirm.cancel = func(m model) model {
+            m.appendAI("[draft discarded]")
+            m.statusMsg = "Draft discarded"
+            return m
+        }
+        return m, nil
+
+    case reposLoadedMsg:
+        m.reposLoaded = true
+        m.scanErr = msg.err
+        if msg.rescan {
+            selected, _ := m.repos.SelectedItem().(repoItem)
+            m.allRepos = carryGitState(m.allRepos, msg.items)
+            m, sizeCmd := m.sortRepos()
+            m = m.selectRepoNamed(selected.name)
+            m.statusMsg = fmt.Sprintf("Found %d repos in %s", len(m.allRepos), m.ccRoot)
+            return m, tea.Batch(gitLookupCmd(repoItems(m.allRepos)), sizeCmd)
+        }
+        m.allRepos = msg.items
+        m, sizeCmd := m.sortRepos()
+        if m.cfg.PersistState {
+            m = m.restoreState()
         }
+        return m, tea.Batch(gitLookupCmd(repoItems(m.allRepos)), sizeCmd)
+
+    case pullOutputMsg:
+        m.pullLog = append(m.pullLog, msg.line)
+        m = m.showPullLog()
+        return m, msg.next
+
+    case pullDoneMsg:
+        m.pullRunning = false
+        m = m.finishPull(msg)
+        return m, gitLookupCmd([]repoItem{msg.repo})
+
+    case repoSizesMsg:
+        m.sizingRepos = false
+        sizes := make(map[string]int64, len(m.repoSizes)+len(msg.sizes))
+        for path, n := range m.repoSizes {
+            sizes[path] = n
+        }
+        for path, n := range msg.sizes {
+            sizes[path] = n
+        }
+        m.repoSizes = sizes
+        if m.sortKey != sortBySize {
+            return m, nil
+        }
+        var cmd tea.Cmd
+        m, cmd = m.sortRepos()
+        m.statusMsg = "Sorted by size"
+        return m, cmd
+
+    case gitStateMsg:
+        var cmd tea.Cmd
+        m, cmd = m.setGitState(msg.path, msg.state)
+        return m, tea.Batch(cmd, msg.next)
+
+    case newRepoMsg:
+        if msg.err != nil {
+            m.setError("new-repo "+msg.name, msg.err)
+            return m, nil
+        }
+        items, err := scanRepos(m.ccRoot)
+        m.allRepos = carryGitState(m.allRepos, items)
+        m.reposLoaded = true
+        m.scanErr = err
+        m.profile = profileDefault
+        m, sizeCmd := m.sortRepos()
+        m = m.selectRepoNamed(msg.name)
+        m = m.loadDocFile(filepath.Join(msg.path, "PROJECT_SUMMARY.md"))
+        m.statusMsg = fmt.Sprintf("Created %s: %s", msg.path, strings.Join(msg.steps, ", "))
+        return m, tea.Batch(gitLookupCmd([]repoItem{{name: msg.name, path: msg.path}}), sizeCmd)
+
+    case grepResultsMsg:
+        m.grepRunning = false
+        items := make([]list.Item, len(msg.hits))
+        for i, h := range msg.hits {
+            items[i] = h
+        }
+        m.grepList.SetItems(items)
+        m.grepList.ResetSelected()
+        m.grepList.Title = fmt.Sprintf("Search: %s", msg.pattern)
+        m.showingGrep = true
+        m.statusMsg = fmt.Sprintf("%d matches in %d files – enter: open, esc: close", len(msg.hits), msg.files)
+        return m, nil
+
+    case docCheckMsg:
+        var cmd tea.Cmd
+        m, cmd = m.reloadDocIfChanged()
+        return m, tea.Batch(cmd, docCheckCmd())
+
+    case flashExpiredMsg:
+        if msg.id == m.flashID {
+            m.statusFlash = ""
+        }
+        return m, nil
+
+    case editorFinishedMsg:
+        if msg.err != nil {
+            m.setError("Editor error", msg.err)
+            return m, nil
+        }
+        m = m.loadDocFile(msg.path)
         return m, nil
 
     case tea.KeyMsg:
@@ -330,8 +2225,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
                 m.commandMode = false
                 m.commandInput.Blur()
                 m.commandInput.SetValue("")
-                m = m.executeCommand(cmdStr)
-                return m, nil
+                return m.executeCommand(cmdStr)
             case "esc":
                 m.commandMode = false
                 m.commandInput.Blur()
@@ -344,89 +2238,143 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
             }
         }
 
-        switch msg.String() {
-        case "ctrl+c", "q":
-            return m, tea.Quit
+        if m.confirm != nil {
+            return m.updateConfirm(msg)
+        }
+        if m.showingErrors {
+            return m.updateErrorPane(msg)
+        }
+        if m.pickingModel {
+            return m.updateModelPicker(msg)
+        }
+        if m.showingGrep {
+            return m.updateGrepList(msg)
+        }
+        if m.activePane == paneAI && m.showAIPane {
+            if next, cmd, handled := m.updateAIPrompt(msg); handled {
+                return next, cmd
+            }
+        }
 
-        case "tab":
-            m.activePane = (m.activePane + 1) % 3
+        // While the repo list is filtering, letters belong to the filter.
+        if m.activePane == paneRepos && m.repos.FilterState() == list.Filtering {
+            break
+        }
 
-        case "a":
+        switch action := m.keys[msg.String()]; action {
+        case actionQuit:
+            m.saveState()
+            return m, tea.Quit
+
+        case actionNextPane:
+            var cmd tea.Cmd
+            m, cmd = m.focusPane((m.activePane + 1) % 3)
+            cmds = append(cmds, cmd)
+
+        case actionToggleAI:
             m.showAIPane = !m.showAIPane
             m = m.resizePanes()
 
-        case "v":
-            m.validating = true
-            report := m.validateRepos()
-            m.mainView.SetContent(report)
-            m.mainView.GotoTop()
-            m.validating = false
+        case actionValidate:
+            m = m.runValidation()
             m.statusMsg = "Validation complete."
 
-        case ":":
+        case actionCommand:
             m.commandMode = true
             m.commandInput.SetValue("")
             m.commandInput.Focus()
             m.statusMsg = "Command mode: type and press Enter"
             return m, nil
 
-        case "1":
+        case actionLayoutDefault:
             m.profile = profileDefault
             m = m.applyProfileFilter()
             m.statusMsg = "Layout: default"
 
-        case "2":
+        case actionLayoutInfra:
             m.profile = profileInfra
             m = m.applyProfileFilter()
             m.statusMsg = "Layout: infra"
 
-        case "3":
+        case actionLayoutAgents:
             m.profile = profileAgents
             m = m.applyProfileFilter()
             m.statusMsg = "Layout: agents"
 
-        case "enter":
-            switch m.activePane {
-            case paneRepos:
+        case actionSelect:
+            if m.activePane == paneRepos {
                 m = m.loadSelectedRepoFile("PROJECT_SUMMARY.md")
-            case paneAI:
-                if !m.aiLoading {
-                    m, cmds = m.handleAISubmit(cmds)
-                }
             }
 
-        // Repo doc shortcuts
-        case "s":
+        case actionEditDoc:
             if m.activePane == paneRepos || m.activePane == paneMain {
-                m = m.loadSelectedRepoFile("PROJECT_SUMMARY.md")
+                var cmd tea.Cmd
+                m, cmd = m.openDocInEditor()
+                cmds = append(cmds, cmd)
             }
-        case "r":
-            if m.activePane == paneRepos || m.activePane == paneMain {
-                m = m.loadSelectedRepoFile("RULES.md")
+
+        case actionDocBack:
+            m = m.stepDocHistory(-1)
+
+        case actionDocForward:
+            m = m.stepDocHistory(+1)
+
+        case actionSplitFocus:
+            if m.split {
+                m.splitFocus = !m.splitFocus
+                var cmd tea.Cmd
+                m, cmd = m.focusPane(paneMain)
+                cmds = append(cmds, cmd)
             }
-        case "g":
-            if m.activePane == paneRepos || m.activePane == paneMain {
-                m = m.loadSelectedRepoFile("AGENTS.md")
+
+        case actionSplitClose:
+            if m.split {
+                m = m.closeSplit()
             }
-        case "i":
-            if m.activePane == paneRepos || m.activePane == paneMain {
-                m = m.loadSelectedRepoFile("INSTRUCTIONS.md")
+
+        case actionPull:
+            if m.activePane != paneAI {
+                return m.startPull()
             }
-        case "j":
-            if m.activePane == paneRepos || m.activePane == paneMain {
-                m = m.loadSelectedRepoFile("JOURNAL.md")
+
+        case actionGrowPane:
+            return m.nudgePane(+1), nil
+
+        case actionShrinkPane:
+            return m.nudgePane(-1), nil
+
+        case actionTogglePin:
+            if m.activePane == paneRepos {
+                m = m.togglePin()
+                return m, nil
             }
-        case "k":
-            if m.activePane == paneRepos || m.activePane == paneMain {
-                m = m.loadSelectedRepoFile("SRS.md")
+
+        case actionToggleErrors:
+            if m.activePane != paneAI {
+                m = m.toggleErrorPane()
+                return m, nil
             }
-        case "t":
-            if m.activePane == paneRepos || m.activePane == paneMain {
-                m = m.loadSelectedRepoFile("TASKS.md")
+
+        case actionSummarize:
+            if m.activePane != paneAI {
+                var cmd tea.Cmd
+                m, cmd = m.summarizeRepo()
+                return m, cmd
             }
-        case "y":
-            if m.activePane == paneRepos || m.activePane == paneMain {
-                m = m.loadSelectedRepoFile("TESTING.md")
+
+        case actionPickModel:
+            if m.activePane != paneAI {
+                var cmd tea.Cmd
+                m, cmd = m.openModelPicker()
+                return m, cmd
+            }
+
+        default:
+            // Repo doc shortcuts
+            if doc, ok := docFor(m.cfg.Docs, action); ok {
+                if m.activePane == paneRepos || m.activePane == paneMain {
+                    m = m.loadSelectedRepoFile(doc.File)
+                }
             }
         }
     }
@@ -440,12 +2388,20 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
     case paneMain:
         var cmd tea.Cmd
-        m.mainView, cmd = m.mainView.Update(msg)
+        if m.split && m.splitFocus {
+            m.splitView, cmd = m.splitView.Update(msg)
+        } else {
+            m.mainView, cmd = m.mainView.Update(msg)
+        }
         cmds = append(cmds, cmd)
 
     case paneAI:
         var cmd tea.Cmd
-        m.aiInput, cmd = m.aiInput.Update(msg)
+        if m.cfg.AI.SingleLineInput {
+            m.aiInput, cmd = m.aiInput.Update(msg)
+        } else {
+            m.aiArea, cmd = m.aiArea.Update(msg)
+        }
         cmds = append(cmds, cmd)
 
         m.aiView, cmd = m.aiView.Update(msg)
@@ -455,22 +2411,153 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
     return m, tea.Batch(cmds...)
 }
 
+// aiAreaHeight is the number of lines in the multi-line AI prompt box.
+const aiAreaHeight = 4
+
+// focusPane makes p the active pane, focusing the AI prompt box only
+// while the AI pane is active so its cursor does not blink elsewhere.
+func (m model) focusPane(p pane) (model, tea.Cmd) {
+    m.activePane = p
+    if p != paneAI {
+        m.aiInput.Blur()
+        m.aiArea.Blur()
+        return m, nil
+    }
+    m = m.loadRepoChat()
+    if m.cfg.AI.SingleLineInput {
+        return m, m.aiInput.Focus()
+    }
+    return m, m.aiArea.Focus()
+}
+
+// updateAIPrompt routes a key to the AI prompt box. The submit keys send
+// the prompt (as does Enter for the single-line box); Tab and the quit
+// keys are left unhandled so they keep their global meaning, while every
+// other key is text, not a hotkey.
+func (m model) updateAIPrompt(msg tea.KeyMsg) (model, tea.Cmd, bool) {
+    action := m.keys[msg.String()]
+    switch {
+    case action == actionSubmitAI || (m.cfg.AI.SingleLineInput && action == actionSelect):
+        if m.aiLoading {
+            return m, nil, true
+        }
+        var cmds []tea.Cmd
+        m, cmds = m.handleAISubmit(cmds)
+        return m, tea.Batch(cmds...), true
+    case action == actionNextPane, msg.Type == tea.KeyCtrlC:
+        return m, nil, false
+    case action == actionClearAI:
+        return m.confirmClearAI(), nil, true
+    case msg.Type == tea.KeyUp && m.aiPromptAtEdge(true):
+        return m.recallAIPrompt(-1), nil, true
+    case msg.Type == tea.KeyDown && m.aiPromptAtEdge(false):
+        return m.recallAIPrompt(+1), nil, true
+    }
+
+    var cmd tea.Cmd
+    if m.cfg.AI.SingleLineInput {
+        m.aiInput, cmd = m.aiInput.Update(msg)
+    } else {
+        m.aiArea, cmd = m.aiArea.Update(msg)
+    }
+    return m, cmd, true
+}
+
+// aiPromptAtEdge reports whether the cursor is on the first (up) or last
+// (!up) visual row of the prompt, where Up/Down browse history instead of
+// moving the cursor. The single-line box is always at both edges.
+func (m model) aiPromptAtEdge(up bool) bool {
+    if m.cfg.AI.SingleLineInput || m.aiArea.Value() == "" {
+        return true
+    }
+    li := m.aiArea.LineInfo()
+    if up {
+        return m.aiArea.Line() == 0 && li.RowOffset == 0
+    }
+    return m.aiArea.Line() == m.aiArea.LineCount()-1 && li.RowOffset == li.Height-1
+}
+
+// recallAIPrompt moves dir (-1 older, +1 newer) through the prompt
+// history and loads that entry into the prompt box. Moving past the newest
+// entry restores the draft that was being typed. An older entry is loaded
+// with the cursor at its start, a newer one with it at the end, so that
+// repeating the key keeps walking in the same direction.
+func (m model) recallAIPrompt(dir int) model {
+    pos := m.aiHistoryPos + dir
+    if pos < 0 || pos > len(m.aiHistory) {
+        return m
+    }
+    if m.aiHistoryPos == len(m.aiHistory) {
+        m.aiDraft = m.aiPrompt()
+    }
+    m.aiHistoryPos = pos
+
+    text := m.aiDraft
+    if pos < len(m.aiHistory) {
+        text = m.aiHistory[pos]
+    }
+    if m.cfg.AI.SingleLineInput {
+        m.aiInput.SetValue(text)
+        m.aiInput.CursorEnd()
+        return m
+    }
+    m.aiArea.SetValue(text) // leaves the cursor at the end
+    if dir < 0 {
+        for i := 0; i < len(text) && (m.aiArea.Line() > 0 || m.aiArea.LineInfo().RowOffset > 0); i++ {
+            m.aiArea.CursorUp()
+        }
+        m.aiArea.CursorStart()
+    }
+    return m
+}
+
+// aiPrompt returns the text in the active AI prompt box.
+func (m model) aiPrompt() string {
+    if m.cfg.AI.SingleLineInput {
+        return m.aiInput.Value()
+    }
+    return m.aiArea.Value()
+}
+
+// resetAIPrompt empties the active AI prompt box.
+func (m *model) resetAIPrompt() {
+    if m.cfg.AI.SingleLineInput {
+        m.aiInput.SetValue("")
+    } else {
+        m.aiArea.Reset()
+    }
+}
+
+// aiPromptView renders the active AI prompt box.
+func (m model) aiPromptView() string {
+    if m.cfg.AI.SingleLineInput {
+        return m.aiInput.View()
+    }
+    return m.aiArea.View()
+}
+
 func (m model) View() string {
     if !m.ready {
-        return "Loading CloudCurio TUI...
-"
+        return "Loading CloudCurio TUI...\n"
     }
 
     repoView := m.repoStyle.Render(m.repos.View())
-    mainView := m.mainStyle.Render(m.mainView.View())
+    mainView := m.mainStyle.Render(m.mainPaneView())
+    switch {
+    case m.showingErrors:
+        mainView = m.mainStyle.Copy().BorderForeground(m.errorStyle.GetForeground()).Render(m.errView.View())
+    case m.pickingModel:
+        mainView = m.mainStyle.Render(m.modelPicker.View())
+    case m.showingGrep:
+        mainView = m.mainStyle.Render(m.grepList.View())
+    }
 
     var aiSection string
     if m.showAIPane {
-        aiCombined := m.aiView.View() + "
-" + m.aiInput.View()
+        aiCombined := m.aiView.View() + "\n" + m.aiPromptView()
         if m.aiLoading {
-            aiCombined += "
-[waiting for AI response...]"
+            elapsed := int(time.Since(m.aiStarted).Seconds())
+            aiCombined += fmt.Sprintf("\n%s waiting for AI response... %ds", m.aiSpinner.View(), elapsed)
         }
         aiSection = m.aiStyle.Render(aiCombined)
     }
@@ -486,364 +2573,2673 @@ func (m model) View() string {
     active := m.activePaneLabel()
     profile := m.profileLabel()
     statusLeft := fmt.Sprintf(
-        "Active: %s | Layout: %s | a: toggle AI | tab: switch pane | v: validate | : command | 1/2/3: layouts | q: quit",
+        "Active: %s | Layout: %s | Sort: %s | AI: %s | %s",
         active,
         profile,
+        m.sortKey,
+        m.aiLabel,
+        m.paneHintText(),
     )
 
     statusText := statusLeft
     if m.statusMsg != "" {
         statusText += "  | " + m.statusMsg
     }
+    if m.statusFlash != "" {
+        statusText += " " + m.statusFlash
+    }
 
     status := m.statusStyle.Render(statusText)
     if m.statusError != "" {
         status += "  " + m.errorStyle.Render(m.statusError)
+        if m.lastError != "" && !m.showingErrors {
+            status += m.statusStyle.Render("(x: details)")
+        }
+    }
+
+    footer := status
+    if m.commandMode {
+        footer = m.commandInput.View() + "\n" + status
+    }
+
+    view := lipgloss.JoinVertical(lipgloss.Left, layout, footer)
+    if m.confirm != nil {
+        view = overlay(view, m.confirmView())
+    }
+    return view
+}
+
+// resizePanes recalculates pane sizes when window or AI toggle changes.
+func (m model) resizePanes() model {
+    if m.width <= 0 || m.height <= 0 {
+        return m
+    }
+
+    height := m.height - 1
+    if height < 5 {
+        height = m.height
+    }
+
+    var repoWidth, mainWidth, aiWidth int
+    if m.showAIPane {
+        repoWidth = int(float64(m.width) * m.repoRatio)
+        aiWidth = int(float64(m.width) * m.aiRatio)
+        mainWidth = m.width - repoWidth - aiWidth
+    } else {
+        repoWidth = int(float64(m.width) * m.repoRatio / (1 - m.aiRatio))
+        mainWidth = m.width - repoWidth
+        aiWidth = 0
+    }
+
+    if repoWidth < 20 {
+        repoWidth = 20
+    }
+    if mainWidth < 20 {
+        mainWidth = 20
+    }
+
+    m.repoPaneWidth = repoWidth
+    m.mainPaneWidth = mainWidth
+
+    m.repos.SetSize(repoWidth-4, height-2)
+    m.mainView.Width = mainWidth - 4
+    m.mainView.Height = height - 2
+    if m.split {
+        m = m.sizeSplit(mainWidth-4, height-2)
+    }
+    m.modelPicker.SetSize(mainWidth-4, height-2)
+    m.grepList.SetSize(mainWidth-4, height-2)
+    m.errView.Width = mainWidth - 4
+    m.errView.Height = height - 2
+
+    if m.showAIPane {
+        inputHeight := 1
+        if !m.cfg.AI.SingleLineInput {
+            inputHeight = aiAreaHeight
+        }
+        m.aiView.Width = aiWidth - 4
+        m.aiView.Height = height - 3 - inputHeight
+        m.aiInput.Width = aiWidth - 4 - lipgloss.Width(m.aiInput.Prompt) - 1
+        m.aiArea.SetWidth(aiWidth - 4)
+    } else {
+        m.aiView.Width = 0
+        m.aiView.Height = 0
+    }
+
+    // Only rebuild the markdown renderer when the wrap width changes.
+    if m.mainView.Width != m.mdWrapWidth {
+        m.mdWrapWidth = m.mainView.Width
+        m.mdRenderer = newMarkdownRenderer(m.mdWrapWidth, m.theme)
+        if m.currentDocPath != "" {
+            offset := m.mainView.YOffset
+            m = m.loadDocFile(m.currentDocPath)
+            m.mainView.SetYOffset(offset)
+        }
+        if m.split {
+            offset := m.splitView.YOffset
+            m = m.loadSplitDoc(m.splitDocPath)
+            m.splitView.SetYOffset(offset)
+        }
+    }
+
+    return m
+}
+
+// Pane ratio limits: each side pane keeps minPaneRatio of the width and
+// the main pane minMainRatio; +/- move a boundary by paneRatioStep.
+const (
+    minPaneRatio  = 0.1
+    minMainRatio  = 0.2
+    paneRatioStep = 0.02
+)
+
+// checkPaneRatios reports whether the repo and AI ratios leave every
+// pane its minimum share of the width.
+func checkPaneRatios(repo, ai float64) error {
+    switch {
+    case repo < minPaneRatio || ai < minPaneRatio:
+        return fmt.Errorf("repo_ratio (%.2f) and ai_ratio (%.2f) must each be at least %.2f", repo, ai, minPaneRatio)
+    case 1-repo-ai < minMainRatio-1e-9: // allow for float rounding
+        return fmt.Errorf("repo_ratio + ai_ratio (%.2f) must leave at least %.2f for the main pane", repo+ai, minMainRatio)
+    }
+    return nil
+}
+
+// nudgePane widens (dir > 0) or narrows the focused pane by one step:
+// the repo pane moves the repo/main boundary, the main pane the
+// main/AI boundary (or repo/main while the AI pane is hidden).
+func (m model) nudgePane(dir float64) model {
+    repo, ai := m.repoRatio, m.aiRatio
+    switch {
+    case m.activePane == paneRepos:
+        repo += dir * paneRatioStep
+    case m.activePane == paneMain && m.showAIPane:
+        ai -= dir * paneRatioStep
+    case m.activePane == paneMain:
+        repo -= dir * paneRatioStep
+    default:
+        return m
+    }
+    // Round so repeated steps do not drift past the limits.
+    repo, ai = math.Round(repo*100)/100, math.Round(ai*100)/100
+    if err := checkPaneRatios(repo, ai); err != nil {
+        m.statusError = "Pane at its size limit"
+        return m
+    }
+    m.repoRatio, m.aiRatio = repo, ai
+    m = m.resizePanes()
+    m.statusError = ""
+    m.statusMsg = fmt.Sprintf("Panes: repos %.0f%%, main %.0f%%, AI %.0f%%", repo*100, (1-repo-ai)*100, ai*100)
+    return m
+}
+
+// handleClick focuses the pane under the given cell and, in the repo pane,
+// selects the clicked row.
+func (m model) handleClick(x, y int) (model, tea.Cmd) {
+    if y >= m.height-1 {
+        return m, nil
+    }
+
+    switch {
+    case x < m.repoPaneWidth:
+        m, _ = m.focusPane(paneRepos)
+        m = m.selectRepoAt(y)
+    case x < m.repoPaneWidth+m.mainPaneWidth:
+        m, _ = m.focusPane(paneMain)
+        if m.split {
+            // Inside the border and padding: x-2 columns, y-1 rows.
+            if m.splitSideBySide {
+                m.splitFocus = x-m.repoPaneWidth-2 > m.mainView.Width
+            } else {
+                m.splitFocus = y-1 > m.mainView.Height
+            }
+        }
+    case m.showAIPane:
+        var cmd tea.Cmd
+        m, cmd = m.focusPane(paneAI)
+        return m, cmd
+    }
+    return m, nil
+}
+
+// selectRepoAt selects the repo list row drawn at screen line y. Rows are
+// located from the list's title/status bar styles and the delegate height.
+func (m model) selectRepoAt(y int) model {
+    if m.repos.FilterState() == list.Filtering {
+        return m
+    }
+
+    // Top border, then the title bar and status bar above the items.
+    top := 1
+    if m.repos.ShowTitle() || m.repos.ShowFilter() {
+        top += lipgloss.Height(m.repos.Styles.TitleBar.Render(m.repos.Title))
+    }
+    if m.repos.ShowStatusBar() {
+        top += lipgloss.Height(m.repos.Styles.StatusBar.Render(""))
+    }
+    if y < top {
+        return m
+    }
+
+    delegate := list.NewDefaultDelegate()
+    row := (y - top) / (delegate.Height() + delegate.Spacing())
+    if row >= m.repos.Paginator.PerPage {
+        return m
+    }
+
+    index := m.repos.Paginator.Page*m.repos.Paginator.PerPage + row
+    if index < len(m.repos.VisibleItems()) {
+        m.repos.Select(index)
+    }
+    return m
+}
+
+func (m model) activePaneLabel() string {
+    switch m.activePane {
+    case paneRepos:
+        return "Repos"
+    case paneMain:
+        return "Main"
+    case paneAI:
+        return "AI"
+    default:
+        return "Unknown"
+    }
+}
+
+func (m model) profileLabel() string {
+    switch m.profile {
+    case profileDefault:
+        return "default"
+    case profileInfra:
+        return "infra"
+    case profileAgents:
+        return "agents"
+    default:
+        return "unknown"
+    }
+}
+
+// applyProfileFilter filters the repo list based on the active layout
+// profile. Pinned repos are always listed, ahead of the rest and in
+// allRepos order.
+func (m model) applyProfileFilter() model {
+    if !m.reposLoaded {
+        return m // keep the scanning placeholder
+    }
+    if len(m.allRepos) == 0 {
+        m.repos.SetItems(emptyRepoItems(m.ccRoot, m.scanErr))
+        return m
+    }
+
+    var filtered []list.Item
+
+    switch m.profile {
+    case profileInfra:
+        for _, it := range m.allRepos {
+            if r, ok := it.(repoItem); ok {
+                name := strings.ToLower(r.name)
+                if strings.Contains(name, "infra") || strings.Contains(name, "cloudcurio-infra") {
+                    filtered = append(filtered, it)
+                }
+            }
+        }
+    case profileAgents:
+        for _, it := range m.allRepos {
+            if r, ok := it.(repoItem); ok {
+                name := strings.ToLower(r.name)
+                if strings.Contains(name, "agent") || strings.Contains(name, "agents") {
+                    filtered = append(filtered, it)
+                }
+            }
+        }
+    default:
+        filtered = m.allRepos
+    }
+
+    // Fallback: if filter produced no results, show all.
+    if len(filtered) == 0 {
+        filtered = m.allRepos
+    }
+
+    m.repos.SetItems(m.pinnedFirst(filtered))
+    return m
+}
+
+// pinnedFirst returns the pinned repos from allRepos, marked, followed by
+// the unpinned repos in items. It always returns a new slice, so allRepos
+// is never reordered.
+func (m model) pinnedFirst(items []list.Item) []list.Item {
+    out := make([]list.Item, 0, len(items))
+    for _, it := range m.allRepos {
+        if r, ok := it.(repoItem); ok && m.pinned[r.name] {
+            r.pinned = true
+            out = append(out, r)
+        }
+    }
+    for _, it := range items {
+        if r, ok := it.(repoItem); ok && m.pinned[r.name] {
+            continue
+        }
+        out = append(out, it)
+    }
+    return out
+}
+
+// Repo list sort keys, for ":sort" and the repo_sort config setting.
+const (
+    sortByName  = "name"
+    sortByMtime = "mtime"
+    sortBySize  = "size"
+)
+
+var sortKeys = []string{sortByName, sortByMtime, sortBySize}
+
+// setSortKey handles ":sort <name|mtime|size>". With no argument it
+// reports the current key.
+func (m model) setSortKey(arg string) (model, tea.Cmd) {
+    if arg == "" {
+        m.statusMsg = "Repos sorted by " + m.sortKey
+        return m, nil
+    }
+    if !containsString(sortKeys, arg) {
+        m.statusError = "Usage: sort <" + strings.Join(sortKeys, "|") + ">"
+        return m, nil
+    }
+
+    m.sortKey = arg
+    m.statusError = ""
+    m, cmd := m.sortRepos()
+    if cmd != nil {
+        m.statusMsg = "Measuring repo sizes..."
+    } else {
+        m.statusMsg = "Sorted by " + arg
+    }
+    return m, cmd
+}
+
+// sortRepos reorders allRepos by sortKey and re-applies the profile
+// filter, keeping the selected repo selected. Sorting by size first needs
+// every repo measured: the missing ones are measured by the returned
+// command, whose repoSizesMsg sorts again.
+func (m model) sortRepos() (model, tea.Cmd) {
+    var selected string
+    if r, ok := m.repos.SelectedItem().(repoItem); ok {
+        selected = r.name
+    }
+
+    var cmd tea.Cmd
+    if m.sortKey == sortBySize {
+        var missing []string
+        for _, r := range repoItems(m.allRepos) {
+            if _, ok := m.repoSizes[r.path]; !ok {
+                missing = append(missing, r.path)
+            }
+        }
+        if len(missing) > 0 {
+            if !m.sizingRepos {
+                m.sizingRepos = true
+                cmd = repoSizesCmd(missing)
+            }
+            // Keep the current order until the sizes arrive.
+            m = m.applyProfileFilter()
+            return m.selectRepoNamed(selected), cmd
+        }
+    }
+
+    // Sort keys are gathered up front so each repo is stat'ed once.
+    mtimes := make(map[string]time.Time)
+    if m.sortKey == sortByMtime {
+        for _, r := range repoItems(m.allRepos) {
+            if info, err := os.Stat(r.path); err == nil {
+                mtimes[r.path] = info.ModTime()
+            }
+        }
+    }
+    less := func(a, b repoItem) bool {
+        switch m.sortKey {
+        case sortByMtime:
+            if ta, tb := mtimes[a.path], mtimes[b.path]; !ta.Equal(tb) {
+                return ta.After(tb)
+            }
+        case sortBySize:
+            if sa, sb := m.repoSizes[a.path], m.repoSizes[b.path]; sa != sb {
+                return sa > sb
+            }
+        }
+        return strings.ToLower(a.name) < strings.ToLower(b.name)
+    }
+
+    // Copy: the visible list may share allRepos' backing array.
+    all := append([]list.Item(nil), m.allRepos...)
+    sort.SliceStable(all, func(i, j int) bool {
+        a, aok := all[i].(repoItem)
+        b, bok := all[j].(repoItem)
+        return aok && bok && less(a, b)
+    })
+    m.allRepos = all
+
+    m = m.applyProfileFilter()
+    return m.selectRepoNamed(selected), cmd
+}
+
+// repoSizesCmd measures each path's recursive size in the background.
+func repoSizesCmd(paths []string) tea.Cmd {
+    return func() tea.Msg {
+        sizes := make(map[string]int64, len(paths))
+        for _, p := range paths {
+            sizes[p] = dirSize(p)
+        }
+        return repoSizesMsg{sizes: sizes}
+    }
+}
+
+// dirSize returns the total size of the regular files under root.
+// Unreadable entries are skipped rather than failing the whole count.
+func dirSize(root string) int64 {
+    var total int64
+    filepath.WalkDir(root, func(_ string, d os.DirEntry, err error) error {
+        if err != nil {
+            return nil
+        }
+        if d.Type().IsRegular() {
+            if info, err := d.Info(); err == nil {
+                total += info.Size()
+            }
+        }
+        return nil
+    })
+    return total
+}
+
+// togglePin pins or unpins the selected repo, keeps it selected as it
+// moves, and saves the state file so the pins survive a restart.
+func (m model) togglePin() model {
+    item, ok := m.repos.SelectedItem().(repoItem)
+    if !ok {
+        m.statusError = "No repo selected"
+        return m
+    }
+
+    // Copy: the map may be shared with earlier model values.
+    pinned := make(map[string]bool, len(m.pinned)+1)
+    for name := range m.pinned {
+        pinned[name] = true
+    }
+    if pinned[item.name] {
+        delete(pinned, item.name)
+        m.statusMsg = "Unpinned " + item.name
+    } else {
+        pinned[item.name] = true
+        m.statusMsg = "Pinned " + item.name
+    }
+    m.pinned = pinned
+
+    m = m.applyProfileFilter()
+    m = m.selectRepoNamed(item.name)
+    m.saveState()
+    return m
+}
+
+// loadSelectedRepoFile reads the given filename for the selected repo and
+// renders it into the main viewport.
+func (m model) loadSelectedRepoFile(filename string) model {
+    item, ok := m.repos.SelectedItem().(repoItem)
+    if !ok {
+        m.statusError = "No repo selected"
+        return m
+    }
+
+    m = m.showRepoDoc(item, filename)
+    if m.currentDocPath == filepath.Join(item.path, filename) {
+        m = m.pushDocHistory(docVisit{repo: item.name, dir: item.path, file: filename})
+    }
+    return m
+}
+
+// showRepoDoc loads filename from repo into the main viewport.
+func (m model) showRepoDoc(repo repoItem, filename string) model {
+    m = m.loadDocFile(filepath.Join(repo.path, filename))
+    if m.split && filepath.Dir(m.splitDocPath) != repo.path {
+        // Keep the second half on the same repo as the first.
+        m = m.loadSplitDoc(filepath.Join(repo.path, filepath.Base(m.splitDocPath)))
+    }
+    return m
+}
+
+// docVisit is one docHistory entry; offset is the scroll position when the
+// doc was last left.
+type docVisit struct {
+    repo   string
+    dir    string
+    file   string
+    offset int
+}
+
+// docHistoryMax caps docHistory; the oldest entries are dropped first.
+const docHistoryMax = 50
+
+// pushDocHistory records v as the newest visit, discarding any forward
+// entries as a browser does. Reopening the doc on screen is not a new
+// visit.
+func (m model) pushDocHistory(v docVisit) model {
+    if m.docHistoryPos >= 0 {
+        cur := m.docHistory[m.docHistoryPos]
+        if cur.dir == v.dir && cur.file == v.file {
+            return m
+        }
+    }
+    // Copy before writing: model copies share the array.
+    hist := append([]docVisit(nil), m.docHistory[:m.docHistoryPos+1]...)
+    if m.docHistoryPos >= 0 {
+        hist[m.docHistoryPos].offset = m.mainView.YOffset
+    }
+    hist = append(hist, v)
+    if len(hist) > docHistoryMax {
+        hist = hist[len(hist)-docHistoryMax:]
+    }
+    m.docHistory = hist
+    m.docHistoryPos = len(hist) - 1
+    return m
+}
+
+// stepDocHistory moves dir (-1 back, +1 forward) through docHistory,
+// reopening that doc at its saved scroll position without recording a
+// new visit.
+func (m model) stepDocHistory(dir int) model {
+    pos := m.docHistoryPos + dir
+    if pos < 0 || pos >= len(m.docHistory) {
+        if dir < 0 {
+            m.statusMsg = "No earlier doc in history"
+        } else {
+            m.statusMsg = "No later doc in history"
+        }
+        return m
+    }
+
+    hist := append([]docVisit(nil), m.docHistory...)
+    hist[m.docHistoryPos].offset = m.mainView.YOffset
+    m.docHistory = hist
+    m.docHistoryPos = pos
+
+    v := hist[pos]
+    m = m.selectRepoNamed(v.repo)
+    m = m.showRepoDoc(repoItem{name: v.repo, path: v.dir}, v.file)
+    m.mainView.SetYOffset(v.offset)
+    return m
+}
+
+// loadDocFile reads the doc at targetPath and renders it into the main
+// viewport, remembering it as the currently displayed doc.
+func (m model) loadDocFile(targetPath string) model {
+    filename := filepath.Base(targetPath)
+    content, modTime, err := m.renderDoc(targetPath)
+    if err != nil {
+        m.mainView.SetContent(fmt.Sprintf("Error reading %s:\n%v", targetPath, err))
+        m.setError(fmt.Sprintf("Failed to load %s", filename), err)
+        return m
+    }
+
+    m.mainView.SetContent(content)
+    m.mainView.GotoTop()
+    m.currentDocPath = targetPath
+    m.currentDocMod = modTime
+    m.pullInMain = false
+    m.statusMsg = fmt.Sprintf("Loaded %s", targetPath)
+    if words, ok := m.docWords(targetPath, modTime); ok {
+        m.statusMsg = fmt.Sprintf("%s — %d words, ~%d min", filename, words, readingMinutes(words))
+    }
+    m.statusError = ""
+    return m
+}
+
+// wordCount is a cached docWords result for one version of a file.
+type wordCount struct {
+    modTime time.Time
+    words   int
+}
+
+// readingWPM is the reading speed behind the reading-time estimate.
+const readingWPM = 200
+
+// docWords counts the words in the raw (pre-glamour) text of the doc at
+// path, cached by mtime. Tokens without a letter or digit, such as "#",
+// "-" and "```", are markup rather than words and are not counted.
+func (m model) docWords(path string, modTime time.Time) (int, bool) {
+    if c, ok := m.wordCounts[path]; ok && c.modTime.Equal(modTime) {
+        return c.words, true
+    }
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return 0, false
+    }
+    words := 0
+    for _, f := range strings.Fields(string(data)) {
+        if strings.IndexFunc(f, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) >= 0 {
+            words++
+        }
+    }
+    if m.wordCounts != nil {
+        m.wordCounts[path] = wordCount{modTime: modTime, words: words}
+    }
+    return words, true
+}
+
+// readingMinutes estimates the minutes needed to read words, rounding up
+// so that any non-empty doc takes at least a minute.
+func readingMinutes(words int) int {
+    return (words + readingWPM - 1) / readingWPM
+}
+
+// reloadDocIfChanged re-reads the displayed doc when its mtime has moved,
+// keeping the scroll position where the new content allows it.
+func (m model) reloadDocIfChanged() (model, tea.Cmd) {
+    if m.pickingModel {
+        return m, nil
+    }
+    // A missing file is usually an editor mid-save; check again later.
+    changed := func(path string, mod time.Time) bool {
+        if path == "" {
+            return false
+        }
+        info, err := os.Stat(path)
+        return err == nil && !info.ModTime().Equal(mod)
+    }
+
+    // Reloading the main doc refreshes its word count in the status line.
+    reloaded := false
+    if changed(m.currentDocPath, m.currentDocMod) {
+        offset := m.mainView.YOffset
+        m = m.loadDocFile(m.currentDocPath)
+        m.mainView.SetYOffset(offset)
+        reloaded = true
+    }
+    if m.split && changed(m.splitDocPath, m.splitDocMod) {
+        offset := m.splitView.YOffset
+        m = m.loadSplitDoc(m.splitDocPath)
+        m.splitView.SetYOffset(offset)
+        reloaded = true
+    }
+    if !reloaded {
+        return m, nil
+    }
+    return m.flash("(reloaded)")
+}
+
+// splitMinWidth is the narrowest half worth showing side by side; below
+// twice this the split stacks the halves instead.
+const splitMinWidth = 40
+
+// openSplit handles ":split <doc>", showing the doc from the selected repo
+// in a second viewport next to the loaded doc.
+func (m model) openSplit(arg string) model {
+    if arg == "" {
+        m.statusError = "Usage: split <doc>"
+        return m
+    }
+    filename := mapDocAliasToFilename(m.cfg.Docs, arg)
+    if filename == "" {
+        filename = arg
+    }
+    item, ok := m.repos.SelectedItem().(repoItem)
+    if !ok {
+        m.statusError = "No repo selected"
+        return m
+    }
+
+    wasSplit := m.split
+    m.split = true
+    m.splitFocus = true
+    if !wasSplit {
+        // Halving the width changes the wrap width, which also reloads
+        // both docs; a no-op here if the window is not sized yet.
+        m.splitDocPath = filepath.Join(item.path, filename)
+        m = m.resizePanes()
+    }
+    m = m.loadSplitDoc(filepath.Join(item.path, filename))
+    if m.statusError == "" {
+        m.statusMsg = fmt.Sprintf("Split: %s – w: switch half, W: close", filename)
+    }
+    return m
+}
+
+// closeSplit returns the main pane to a single viewport.
+func (m model) closeSplit() model {
+    m.split = false
+    m.splitFocus = false
+    m.splitDocPath = ""
+    m.splitView.SetContent("")
+    m = m.resizePanes()
+    m.statusMsg = "Split closed"
+    return m
+}
+
+// loadSplitDoc renders the doc at path into the second half of the split.
+func (m model) loadSplitDoc(path string) model {
+    m.splitDocPath = path
+    content, modTime, err := m.renderDoc(path)
+    if err != nil {
+        m.splitView.SetContent(fmt.Sprintf("Error reading %s:\n%v", path, err))
+        m.splitDocMod = time.Time{}
+        m.setError(fmt.Sprintf("Failed to load %s", filepath.Base(path)), err)
+        return m
+    }
+    m.splitView.SetContent(content)
+    m.splitView.GotoTop()
+    m.splitDocMod = modTime
+    return m
+}
+
+// sizeSplit divides the main pane's inner width x height between the two
+// halves, each of which also loses a line to its title.
+func (m model) sizeSplit(width, height int) model {
+    m.splitSideBySide = width >= 2*splitMinWidth
+    if m.splitSideBySide {
+        half := (width - 1) / 2 // one column for the divider
+        m.mainView.Width, m.splitView.Width = half, width-1-half
+        m.mainView.Height, m.splitView.Height = height-1, height-1
+        return m
+    }
+    top := (height - 2) / 2
+    m.mainView.Width, m.splitView.Width = width, width
+    m.mainView.Height, m.splitView.Height = top, height-2-top
+    return m
+}
+
+// mainPaneView renders the main pane body: the doc viewport, or both
+// halves of a split with a title over each, the focused one highlighted.
+func (m model) mainPaneView() string {
+    if !m.split {
+        return m.mainView.View()
+    }
+    title := func(path string, focused bool, width int) string {
+        name := filepath.Base(path)
+        if path == "" {
+            name = "(no doc)"
+        }
+        style := m.statusStyle.Copy().PaddingLeft(0).MaxWidth(width)
+        if focused && m.activePane == paneMain {
+            return style.Bold(true).Render("▶ " + name)
+        }
+        return style.Render("  " + name)
+    }
+    first := title(m.currentDocPath, !m.splitFocus, m.mainView.Width) + "\n" + m.mainView.View()
+    second := title(m.splitDocPath, m.splitFocus, m.splitView.Width) + "\n" + m.splitView.View()
+    if !m.splitSideBySide {
+        return lipgloss.JoinVertical(lipgloss.Left, first, second)
+    }
+    divider := strings.TrimSuffix(strings.Repeat("│\n", m.mainView.Height+1), "\n")
+    return lipgloss.JoinHorizontal(lipgloss.Top, first, divider, second)
+}
+
+// renderDoc returns the display text and mtime of the doc at path.
+// Markdown is rendered with glamour and cached by (path, mtime, wrap
+// width), so re-opening an unchanged doc skips both the read and render.
+func (m model) renderDoc(path string) (string, time.Time, error) {
+    info, err := os.Stat(path)
+    if err != nil {
+        return "", time.Time{}, err
+    }
+
+    markdown := m.mdRenderer != nil && strings.HasSuffix(strings.ToLower(path), ".md")
+    key := renderKey{path: path, modTime: info.ModTime(), wrap: m.mdWrapWidth}
+    if markdown && m.mdCache != nil {
+        if cached, ok := m.mdCache.get(key); ok {
+            return cached, info.ModTime(), nil
+        }
+    }
+
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return "", time.Time{}, err
+    }
+    content := string(data)
+    if !markdown {
+        return content, info.ModTime(), nil
+    }
+
+    rendered, err := m.mdRenderer.Render(content)
+    if err != nil {
+        return content, info.ModTime(), nil
+    }
+    if m.mdCache != nil {
+        m.mdCache.put(key, rendered)
+    }
+    return rendered, info.ModTime(), nil
+}
+
+// openDocInEditor suspends the TUI and opens the currently loaded doc in
+// $EDITOR. The doc is reloaded into the main viewport when the editor exits.
+func (m model) openDocInEditor() (model, tea.Cmd) {
+    if m.sshSession {
+        m.statusError = "External editor is not available over SSH"
+        return m, nil
+    }
+    if m.currentDocPath == "" {
+        m.statusError = "No doc loaded to edit"
+        return m, nil
+    }
+
+    editor := os.Getenv("EDITOR")
+    if editor == "" {
+        editor = "vim"
+    }
+
+    // EDITOR may carry arguments, e.g. "code --wait".
+    parts := strings.Fields(editor)
+    path := m.currentDocPath
+    return m.askConfirm(fmt.Sprintf("Open %s in %s? Saved changes are written to disk.", path, parts[0]), func(m model) (model, tea.Cmd) {
+        c := exec.Command(parts[0], append(parts[1:], path)...)
+        m.statusMsg = fmt.Sprintf("Editing %s with %s", path, parts[0])
+        m.statusError = ""
+        return m, tea.ExecProcess(c, func(err error) tea.Msg {
+            return editorFinishedMsg{path: path, err: err}
+        })
+    }), nil
+}
+
+// setError shows summary in the status line and keeps the full error text
+// for the error pane. Multi-line errors show only the summary inline.
+func (m *model) setError(summary string, err error) {
+    m.statusError = fmt.Sprintf("%s: %v", summary, err)
+    if strings.Contains(err.Error(), "\n") {
+        m.statusError = summary
+    }
+    m.lastError = summary + "\n\n" + prettyErrorText(err.Error())
+    m.lastErrorAt = time.Now()
+    slog.Error(summary, "err", err)
+    if m.showingErrors {
+        m.errView.SetContent(wrapText(m.errorPaneContent(), m.errView.Width))
+    }
+}
+
+// prettyErrorText indents a JSON body embedded in an error message (as in
+// "openai api error: {...}") so API errors are readable.
+func prettyErrorText(text string) string {
+    i := strings.IndexAny(text, "{[")
+    if i < 0 {
+        return text
+    }
+    var buf bytes.Buffer
+    if err := json.Indent(&buf, []byte(strings.TrimSpace(text[i:])), "", "  "); err != nil {
+        return text
+    }
+    return text[:i] + "\n" + buf.String()
+}
+
+func (m model) errorPaneContent() string {
+    if m.lastError == "" {
+        return "No errors so far."
+    }
+    return fmt.Sprintf("Last error (%s)\n\n%s", m.lastErrorAt.Format("15:04:05"), m.lastError)
+}
+
+// toggleErrorPane shows or hides the full text of the last error in place
+// of the main pane.
+func (m model) toggleErrorPane() model {
+    m.showingErrors = !m.showingErrors
+    if m.showingErrors {
+        m.errView.SetContent(wrapText(m.errorPaneContent(), m.errView.Width))
+        m.errView.GotoTop()
+        m.statusMsg = "Error details – ↑/↓ scroll, x/esc close"
+    }
+    return m
+}
+
+// updateErrorPane scrolls the error pane; x or esc closes it.
+func (m model) updateErrorPane(msg tea.KeyMsg) (model, tea.Cmd) {
+    switch {
+    case msg.String() == "esc" || m.keys[msg.String()] == actionToggleErrors:
+        m.showingErrors = false
+        m.statusMsg = ""
+        return m, nil
+    case m.keys[msg.String()] == actionQuit:
+        m.saveState()
+        return m, tea.Quit
+    }
+    var cmd tea.Cmd
+    m.errView, cmd = m.errView.Update(msg)
+    return m, cmd
+}
+
+// wrapText hard-wraps text to width so long single-line error bodies stay
+// visible in a viewport.
+func wrapText(text string, width int) string {
+    if width <= 0 {
+        return text
+    }
+    return lipgloss.NewStyle().Width(width).Render(text)
+}
+
+// aiEmptyText is the placeholder shown in the AI pane before the first
+// message and after :clear.
+func aiEmptyText(cfg AIConfig) string {
+    send := "ctrl+s"
+    if cfg.SingleLineInput {
+        send = "Enter"
+    }
+    return "AI Chat Pane\n\n" +
+        "Type in the input below and press " + send + " to send.\n" +
+        "Configure OPENAI_API_KEY, OPENROUTER_API_KEY or GEMINI_API_KEY to enable real responses."
+}
+
+// appendAI appends a line to the AI conversation, replacing the
+// placeholder on the first line.
+func (m *model) appendAI(line string) {
+    if m.aiLog == "" {
+        m.aiLog = line
+    } else {
+        m.aiLog += "\n" + line
+    }
+    m.aiView.SetContent(m.aiLog)
+    m.aiView.GotoBottom()
+}
+
+// clearAI empties the AI conversation, truncating the shown repo's chat
+// log, and restores the placeholder. A response still in flight is
+// appended to the fresh conversation.
+func (m model) clearAI() model {
+    if m.chatRepo != "" {
+        err := os.Truncate(filepath.Join(m.chatRepo, chatLogName), 0)
+        if err != nil && !os.IsNotExist(err) {
+            m.setError("Cannot clear chat log", err)
+            return m
+        }
+    }
+    m.aiLog = ""
+    m.chatTurns = nil
+    m.aiView.SetContent(aiEmptyText(m.cfg.AI))
+    m.aiView.GotoTop()
+    m.statusMsg = "AI conversation cleared"
+    m.statusError = ""
+    return m
+}
+
+// confirmClearAI clears the AI conversation, asking first when that would
+// truncate a non-empty chat log on disk.
+func (m model) confirmClearAI() model {
+    if m.chatRepo != "" {
+        path := filepath.Join(m.chatRepo, chatLogName)
+        if info, err := os.Stat(path); err == nil && info.Size() > 0 {
+            return m.askConfirm("Clear the AI conversation and truncate "+path+"?", func(m model) (model, tea.Cmd) {
+                return m.clearAI(), nil
+            })
+        }
+    }
+    return m.clearAI()
+}
+
+// chatLogName is the file in each repo that keeps its AI conversation,
+// one chatTurn per line.
+const chatLogName = ".cc-chat.jsonl"
+
+// chatLoadLimit caps how many of a repo's most recent turns are loaded
+// into the AI pane.
+const chatLoadLimit = 200
+
+// chatHistoryTurns is how many of the most recent user and assistant turns
+// are sent with a question, so follow-ups can refer to earlier answers.
+const chatHistoryTurns = 10
+
+// errChatLogCorrupt marks a chat log line that is not a chatTurn.
+var errChatLogCorrupt = errors.New("corrupt chat log")
+
+// chatTurn is one line of a repo's chat log.
+type chatTurn struct {
+    Time time.Time `json:"time"`
+    Role string    `json:"role"` // "user", "assistant" or "error"
+    Text string    `json:"text"`
+}
+
+// chatRolePrefixes are how each chatTurn role is shown in the AI pane.
+var chatRolePrefixes = map[string]string{
+    "user":      "You: ",
+    "assistant": "AI: ",
+    "error":     "[error] ",
+}
+
+// readChatLog returns the turns in the chat log at path, or none when it
+// does not exist. A line that is not a chatTurn is errChatLogCorrupt.
+func readChatLog(path string) ([]chatTurn, error) {
+    f, err := os.Open(path)
+    if os.IsNotExist(err) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+
+    var turns []chatTurn
+    sc := bufio.NewScanner(f)
+    sc.Buffer(make([]byte, 64*1024), 16<<20)
+    for n := 1; sc.Scan(); n++ {
+        line := bytes.TrimSpace(sc.Bytes())
+        if len(line) == 0 {
+            continue
+        }
+        var t chatTurn
+        if err := json.Unmarshal(line, &t); err != nil || chatRolePrefixes[t.Role] == "" {
+            return nil, fmt.Errorf("%w: line %d", errChatLogCorrupt, n)
+        }
+        turns = append(turns, t)
+    }
+    return turns, sc.Err()
+}
+
+// appendChatLog appends turn to the chat log at path, creating it.
+func appendChatLog(path string, turn chatTurn) error {
+    data, err := json.Marshal(turn)
+    if err != nil {
+        return err
+    }
+    f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+    if err != nil {
+        return err
+    }
+    if _, err := f.Write(append(data, '\n')); err != nil {
+        f.Close()
+        return err
+    }
+    return f.Close()
+}
+
+// loadRepoChat shows the selected repo's chat log in the AI pane, unless
+// it is already shown. An unreadable log starts a fresh conversation with
+// a warning; a corrupt one is also moved aside to <log>.corrupt so new
+// turns are not appended to it.
+func (m model) loadRepoChat() model {
+    item, ok := m.repos.SelectedItem().(repoItem)
+    if !ok || item.path == m.chatRepo {
+        return m
+    }
+    m.chatRepo = item.path
+    m.aiLog = ""
+
+    path := filepath.Join(item.path, chatLogName)
+    turns, err := readChatLog(path)
+    if err != nil {
+        summary := "Chat log for " + item.name + " unreadable, starting fresh"
+        if errors.Is(err, errChatLogCorrupt) {
+            if rerr := os.Rename(path, path+".corrupt"); rerr == nil {
+                summary = "Chat log for " + item.name + " is corrupt, moved to " + chatLogName + ".corrupt"
+            }
+        }
+        m.setError(summary, err)
+        turns = nil
+    }
+    if len(turns) > chatLoadLimit {
+        turns = turns[len(turns)-chatLoadLimit:]
+    }
+    m.chatTurns = turns
+
+    lines := make([]string, 0, len(turns))
+    for _, t := range turns {
+        lines = append(lines, chatRolePrefixes[t.Role]+t.Text)
+    }
+    m.aiLog = strings.Join(lines, "\n")
+    if m.aiLog == "" {
+        m.aiView.SetContent(aiEmptyText(m.cfg.AI))
+        m.aiView.GotoTop()
+    } else {
+        m.aiView.SetContent(m.aiLog)
+        m.aiView.GotoBottom()
+    }
+    return m
+}
+
+// recordAI appends a turn to the chat log of the repo at repoPath, and to
+// the AI pane when that is the conversation it shows.
+func (m *model) recordAI(repoPath, role, text string) {
+    turn := chatTurn{Time: time.Now(), Role: role, Text: text}
+    if repoPath == m.chatRepo {
+        m.appendAI(chatRolePrefixes[role] + text)
+        // Cap the slice so append copies: model copies share the array.
+        n := len(m.chatTurns)
+        m.chatTurns = append(m.chatTurns[:n:n], turn)
+    }
+    if repoPath == "" {
+        return
+    }
+    if err := appendChatLog(filepath.Join(repoPath, chatLogName), turn); err != nil {
+        m.setError("Cannot save chat log", err)
+    }
+}
+
+// chatHistory returns the last chatHistoryTurns user and assistant turns of
+// the loaded conversation, oldest first. Error turns are never sent.
+func (m model) chatHistory() []chatTurn {
+    var history []chatTurn
+    for _, t := range m.chatTurns {
+        if t.Role == "user" || t.Role == "assistant" {
+            history = append(history, t)
+        }
+    }
+    if len(history) > chatHistoryTurns {
+        history = history[len(history)-chatHistoryTurns:]
+    }
+    return history
+}
+
+// showAIContext renders the messages the current AI prompt would send, for
+// the selected repo, in the main pane. Nothing is sent.
+func (m model) showAIContext() model {
+    prompt := strings.TrimSpace(m.aiPrompt())
+    context, picked := m.aiQuestionContext(prompt)
+    m = m.loadRepoChat()
+    item, _ := m.repos.SelectedItem().(repoItem)
+    system, source := systemPromptFor(m.cfg.AI, item.path)
+    messages := buildAIMessages(system, prompt, context, m.chatHistory())
+
+    var b strings.Builder
+    fmt.Fprintf(&b, "AI request preview (%s, system prompt: %s) – nothing has been sent\n", m.cfg.AI.label(), source)
+    chars := 0
+    for i, msg := range messages {
+        content := msg.Content
+        if i == len(messages)-1 && prompt == "" {
+            content = "(empty – type a prompt in the AI pane)"
+        }
+        chars += len(msg.Content)
+        fmt.Fprintf(&b, "\n── %d. %s ──\n%s\n", i+1, msg.Role, content)
+    }
+    fmt.Fprintf(&b, "\n%d messages, %d characters (~%d tokens)", len(messages), chars, chars/4)
+
+    m.currentDocPath = ""
+    m.pullInMain = false
+    m.statusError = ""
+    m.mainView.SetContent(wrapText(b.String(), m.mainView.Width))
+    m.mainView.GotoTop()
+    m.statusMsg = "AI context preview (" + pickedDocsLabel(picked) + ")"
+    return m
+}
+
+// handleAISubmit collects the prompt, appends it to the AI view, and triggers
+// an async AI call via tea.Cmd.
+func (m model) handleAISubmit(cmds []tea.Cmd) (model, []tea.Cmd) {
+    prompt := strings.TrimSpace(m.aiPrompt())
+    if prompt == "" {
+        return m, cmds
+    }
+
+    context, picked := m.aiQuestionContext(prompt)
+
+    m = m.loadRepoChat()
+    history := m.chatHistory()
+    m.chatPending = m.chatRepo
+    m.recordAI(m.chatRepo, "user", prompt)
+    m.resetAIPrompt()
+    if n := len(m.aiHistory); n == 0 || m.aiHistory[n-1] != prompt {
+        m.aiHistory = append(m.aiHistory, prompt)
+    }
+    m.aiHistoryPos = len(m.aiHistory)
+    m.aiDraft = ""
+    m.aiLoading = true
+    m.aiStarted = time.Now()
+    m.statusMsg = "Sending prompt to AI backend (" + pickedDocsLabel(picked) + ")..."
+
+    item, _ := m.repos.SelectedItem().(repoItem)
+    system, _ := systemPromptFor(m.cfg.AI, item.path)
+    cmd := aiRequestCmd(m.cfg.AI, buildAIMessages(system, prompt, context, history))
+    cmds = append(cmds, cmd, m.aiSpinner.Tick)
+
+    return m, cmds
+}
+
+// startNewRepo handles ":new-repo <name> [--git]": it creates
+// CC_ROOT/<name> with every required doc, optionally runs git init, and
+// then selects the new repo. An existing directory is never touched.
+func (m model) startNewRepo(args []string) (model, tea.Cmd) {
+    var name string
+    gitInit := false
+    for _, a := range args {
+        switch {
+        case a == "--git" || a == "-g":
+            gitInit = true
+        case name == "":
+            name = a
+        default:
+            m.statusError = "Usage: new-repo <name> [--git]"
+            return m, nil
+        }
+    }
+    if name == "" || name == "." || name == ".." || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) {
+        m.statusError = "Usage: new-repo <name> [--git] (name must be a plain directory name)"
+        return m, nil
+    }
+
+    path := filepath.Join(m.ccRoot, name)
+    if _, err := os.Stat(path); err == nil {
+        m.statusError = fmt.Sprintf("%s already exists; not overwriting", path)
+        return m, nil
+    }
+
+    prompt := fmt.Sprintf("Create %s with %d docs", path, len(m.requiredDocs))
+    if gitInit {
+        prompt += " and run git init"
+    }
+    return m.askConfirm(prompt+"?", func(m model) (model, tea.Cmd) {
+        m.statusMsg = fmt.Sprintf("Creating %s...", path)
+        m.statusError = ""
+        docs := append([]string(nil), m.requiredDocs...)
+        templates := m.cfg.TemplatesDir
+        return m, func() tea.Msg {
+            steps, err := createRepo(path, name, docs, templates, gitInit)
+            return newRepoMsg{name: name, path: path, steps: steps, err: err}
+        }
+    }), nil
+}
+
+// createRepo makes the repo directory and writes each doc from a template.
+// It fails rather than reusing a directory that already exists.
+func createRepo(path, name string, docs []string, templatesDir string, gitInit bool) ([]string, error) {
+    if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+        return nil, err
+    }
+    if err := os.Mkdir(path, 0o755); err != nil {
+        return nil, err
+    }
+
+    var steps []string
+    for _, doc := range docs {
+        content := docTemplate(templatesDir, doc, name)
+        if err := os.WriteFile(filepath.Join(path, doc), []byte(content), 0o644); err != nil {
+            return steps, err
+        }
+    }
+    steps = append(steps, fmt.Sprintf("%d docs", len(docs)))
+
+    if gitInit {
+        out, err := exec.Command("git", "init", "-q", path).CombinedOutput()
+        if err != nil {
+            return steps, fmt.Errorf("git init: %v: %s", err, strings.TrimSpace(string(out)))
+        }
+        steps = append(steps, "git init")
+    }
+    return steps, nil
+}
+
+// docTemplate returns the starting content for doc in a new repo: the
+// user's template from templatesDir when present, otherwise a stub.
+func docTemplate(templatesDir, doc, repoName string) string {
+    if data, err := os.ReadFile(filepath.Join(templatesDir, doc)); err == nil {
+        return strings.ReplaceAll(string(data), "{{name}}", repoName)
+    }
+
+    title := strings.ReplaceAll(strings.TrimSuffix(doc, filepath.Ext(doc)), "_", " ")
+    return fmt.Sprintf("# %s – %s\n\nTODO: write the %s document for %s.\n", repoName, title, title, repoName)
+}
+
+var (
+    diffAddStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
+    diffDelStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+    diffHunkStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("6"))
+    diffFileStyle = lipgloss.NewStyle().Bold(true)
+)
+
+// diffDocs handles ":diff <repoA> <repoB> <doc>", rendering a colorized
+// unified diff of the doc between two repos in the main pane. A doc
+// missing on one side is diffed against an empty file and labelled.
+func (m model) diffDocs(args []string) model {
+    if len(args) != 3 {
+        m.statusError = "Usage: diff <repoA> <repoB> <doc>"
+        return m
+    }
+    filename := mapDocAliasToFilename(m.cfg.Docs, args[2])
+    if filename == "" {
+        filename = args[2]
+    }
+
+    var sides [2]struct {
+        label string
+        text  string
+        found bool
+    }
+    for i, name := range args[:2] {
+        repo, ok := m.findRepo(name)
+        if !ok {
+            m.statusError = "Unknown repo: " + name
+            return m
+        }
+        sides[i].label = repo.name + "/" + filename
+        data, err := os.ReadFile(filepath.Join(repo.path, filename))
+        switch {
+        case err == nil:
+            sides[i].text = string(data)
+            sides[i].found = true
+        case os.IsNotExist(err):
+            sides[i].label += " (does not exist)"
+        default:
+            m.setError("Read "+sides[i].label, err)
+            return m
+        }
+    }
+    if !sides[0].found && !sides[1].found {
+        m.statusError = fmt.Sprintf("%s exists in neither %s nor %s", filename, args[0], args[1])
+        return m
+    }
+
+    diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+        A:        difflib.SplitLines(sides[0].text),
+        B:        difflib.SplitLines(sides[1].text),
+        FromFile: sides[0].label,
+        ToFile:   sides[1].label,
+        Context:  3,
+    })
+    if err != nil {
+        m.setError("Diff failed", err)
+        return m
+    }
+
+    m.currentDocPath = ""
+    m.pullInMain = false
+    m.statusError = ""
+    if diff == "" {
+        m.mainView.SetContent(fmt.Sprintf("%s and %s are identical.", sides[0].label, sides[1].label))
+        m.statusMsg = "No differences"
+        return m
+    }
+    m.mainView.SetContent(colorizeDiff(diff))
+    m.mainView.GotoTop()
+    m.statusMsg = fmt.Sprintf("diff %s %s %s", args[0], args[1], filename)
+    return m
+}
+
+// findRepo looks up a repo by name (case-insensitive) among all repos.
+func (m model) findRepo(name string) (repoItem, bool) {
+    for _, it := range m.allRepos {
+        if r, ok := it.(repoItem); ok && strings.EqualFold(r.name, name) {
+            return r, true
+        }
+    }
+    return repoItem{}, false
+}
+
+// colorizeDiff styles the lines of a unified diff.
+func colorizeDiff(diff string) string {
+    lines := strings.Split(strings.TrimSuffix(diff, "\n"), "\n")
+    for i, line := range lines {
+        switch {
+        case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+            lines[i] = diffFileStyle.Render(line)
+        case strings.HasPrefix(line, "@@"):
+            lines[i] = diffHunkStyle.Render(line)
+        case strings.HasPrefix(line, "+"):
+            lines[i] = diffAddStyle.Render(line)
+        case strings.HasPrefix(line, "-"):
+            lines[i] = diffDelStyle.Render(line)
+        }
+    }
+    return strings.Join(lines, "\n")
+}
+
+// summaryDocs are the docs fed to the AI by summarizeRepo, in order.
+var summaryDocs = []string{"PROJECT_SUMMARY.md", "RULES.md", "AGENTS.md"}
+
+// summaryCharBudget caps the doc text sent for a summary, at roughly four
+// characters per token (~3k tokens).
+const summaryCharBudget = 12000
+
+// summarizeRepo asks the AI backend for an overview of the selected repo,
+// built from its summary docs rather than typed input.
+func (m model) summarizeRepo() (model, tea.Cmd) {
+    item, ok := m.repos.SelectedItem().(repoItem)
+    if !ok {
+        m.statusError = "No repo selected"
+        return m, nil
+    }
+    if m.aiLoading {
+        m.statusError = "Waiting for the previous AI response"
+        return m, nil
+    }
+
+    prompt, missing := buildSummaryPrompt(item)
+    if prompt == "" {
+        m.statusError = fmt.Sprintf("%s has none of %s", item.name, strings.Join(summaryDocs, ", "))
+        return m, nil
+    }
+
+    if !m.showAIPane {
+        m.showAIPane = true
+        m = m.resizePanes()
+    }
+    note := "[summarize " + item.name + "]"
+    if len(missing) > 0 {
+        note += " (missing: " + strings.Join(missing, ", ") + ")"
+    }
+    m = m.loadRepoChat()
+    history := m.chatHistory()
+    m.chatPending = m.chatRepo
+    m.recordAI(m.chatRepo, "user", note)
+    m.aiLoading = true
+    m.aiStarted = time.Now()
+    m.statusMsg = "Summarizing " + item.name + "..."
+    m.statusError = ""
+
+    system, _ := systemPromptFor(m.cfg.AI, item.path)
+    messages := buildAIMessages(system, prompt, aiRepoContext(item.name, m.ccRoot), history)
+    return m, tea.Batch(aiRequestCmd(m.cfg.AI, messages), m.aiSpinner.Tick)
+}
+
+// promptFileData is the data available to ":ai-file" templates.
+type promptFileData struct {
+    Repo     string // selected repo name
+    RepoPath string // selected repo directory
+    Doc      string // file name of the doc in the main pane
+    Root     string // CC_ROOT
+}
+
+// submitPromptFile handles ":ai-file <path>": it renders the file as a
+// text/template with the current selection ({{.Repo}}, {{.Doc}}, ...) and
+// sends the result as an AI prompt. Parse and execution errors are shown
+// instead of sending a half-rendered prompt.
+func (m model) submitPromptFile(path string) (model, tea.Cmd) {
+    if path == "" {
+        m.statusError = "Usage: :ai-file <path>"
+        return m, nil
+    }
+    if m.aiLoading {
+        m.statusError = "Waiting for the previous AI response"
+        return m, nil
+    }
+    if home, err := os.UserHomeDir(); err == nil {
+        path = expandHome(path, home)
+    }
+
+    data, err := os.ReadFile(path)
+    if err != nil {
+        m.setError("ai-file", err)
+        return m, nil
+    }
+
+    item, _ := m.repos.SelectedItem().(repoItem)
+    doc := ""
+    if m.currentDocPath != "" {
+        doc = filepath.Base(m.currentDocPath)
+    }
+    prompt, err := renderPromptFile(filepath.Base(path), string(data), promptFileData{
+        Repo:     item.name,
+        RepoPath: item.path,
+        Doc:      doc,
+        Root:     m.ccRoot,
+    })
+    if err != nil {
+        m.setError("ai-file template "+filepath.Base(path), err)
+        return m, nil
+    }
+    if prompt == "" {
+        m.statusError = filepath.Base(path) + " rendered an empty prompt"
+        return m, nil
+    }
+
+    if !m.showAIPane {
+        m.showAIPane = true
+        m = m.resizePanes()
+    }
+    m = m.loadRepoChat()
+    history := m.chatHistory()
+    m.chatPending = m.chatRepo
+    m.recordAI(m.chatRepo, "user", "["+filepath.Base(path)+"]\n"+prompt)
+    m.aiLoading = true
+    m.aiStarted = time.Now()
+    m.statusMsg = "Sending " + filepath.Base(path) + " to AI backend..."
+    m.statusError = ""
+
+    system, _ := systemPromptFor(m.cfg.AI, item.path)
+    messages := buildAIMessages(system, prompt, aiRepoContext(item.name, m.ccRoot), history)
+    return m, tea.Batch(aiRequestCmd(m.cfg.AI, messages), m.aiSpinner.Tick)
+}
+
+// renderPromptFile executes text as a template named name. Referencing a
+// field promptFileData does not have is an execution error.
+func renderPromptFile(name, text string, data promptFileData) (string, error) {
+    tmpl, err := template.New(name).Parse(text)
+    if err != nil {
+        return "", err
+    }
+    var b strings.Builder
+    if err := tmpl.Execute(&b, data); err != nil {
+        return "", err
+    }
+    return strings.TrimSpace(b.String()), nil
+}
+
+// buildSummaryPrompt builds the overview prompt from the repo's summary
+// docs and returns it along with the docs that were missing. The prompt
+// is empty when no doc exists.
+func buildSummaryPrompt(repo repoItem) (string, []string) {
+    sections, found, missing := readRepoDocs(repo, summaryDocs, summaryCharBudget)
+    if len(found) == 0 {
+        return "", missing
+    }
+
+    var b strings.Builder
+    fmt.Fprintf(&b, "Give a concise overview of the %q repository: its purpose, key rules, and the agents or roles involved. Use short bullet points.\n", repo.name)
+    if len(missing) > 0 {
+        fmt.Fprintf(&b, "These docs do not exist, so note the gaps rather than guessing: %s.\n", strings.Join(missing, ", "))
+    }
+    b.WriteString(sections)
+    return b.String(), missing
+}
+
+// readRepoDocs reads the named docs from repo, splitting budget (in
+// characters) evenly between the docs that exist, and returns them as
+// "--- NAME ---" sections with the found and missing doc names.
+func readRepoDocs(repo repoItem, docs []string, budget int) (string, []string, []string) {
+    var (
+        found   []string
+        bodies  []string
+        missing []string
+    )
+    for _, doc := range docs {
+        data, err := os.ReadFile(filepath.Join(repo.path, doc))
+        if err != nil {
+            missing = append(missing, doc)
+            continue
+        }
+        found = append(found, doc)
+        bodies = append(bodies, string(data))
+    }
+    if len(found) == 0 {
+        return "", found, missing
+    }
+
+    per := budget / len(found)
+    var b strings.Builder
+    for i, doc := range found {
+        body := bodies[i]
+        if len(body) > per {
+            body = strings.ToValidUTF8(body[:per], "") + "\n[... truncated]"
+        }
+        fmt.Fprintf(&b, "\n--- %s ---\n%s\n", doc, body)
+    }
+    return b.String(), found, missing
+}
+
+// startScaffold asks the AI backend to draft a missing required doc for
+// the selected repo, using the repo's other docs as context. The draft is
+// shown in the AI pane and written only after confirmation.
+func (m model) startScaffold(alias string) (model, tea.Cmd) {
+    filename := mapDocAliasToFilename(m.cfg.Docs, alias)
+    if filename == "" {
+        m.statusError = "Unknown doc alias: " + alias
+        return m, nil
+    }
+    item, ok := m.repos.SelectedItem().(repoItem)
+    if !ok {
+        m.statusError = "No repo selected"
+        return m, nil
+    }
+    target := filepath.Join(item.path, filename)
+    if _, err := os.Stat(target); err == nil {
+        m.statusError = fmt.Sprintf("%s already exists in %s; not overwriting", filename, item.name)
+        return m, nil
+    }
+    if m.aiLoading {
+        m.statusError = "Waiting for the previous AI response"
+        return m, nil
+    }
+
+    var others []string
+    for _, doc := range m.requiredDocs {
+        if doc != filename {
+            others = append(others, doc)
+        }
+    }
+    sections, found, _ := readRepoDocs(item, others, summaryCharBudget)
+
+    var b strings.Builder
+    fmt.Fprintf(&b, "Draft %s for the %q repository in Markdown. Reply with the document only, no commentary.\n", filename, item.name)
+    if len(found) == 0 {
+        b.WriteString("The repository has no other docs yet; write a sensible skeleton with TODO markers.\n")
+    } else {
+        b.WriteString("Keep it consistent with these existing docs:\n")
+        b.WriteString(sections)
+    }
+
+    if !m.showAIPane {
+        m.showAIPane = true
+        m = m.resizePanes()
+    }
+    m.appendAI(fmt.Sprintf("You: [ai-scaffold %s for %s]", filename, item.name))
+    m.aiLoading = true
+    m.aiStarted = time.Now()
+    m.statusMsg = fmt.Sprintf("Drafting %s...", filename)
+    m.statusError = ""
+
+    cfg := m.cfg.AI
+    system, _ := systemPromptFor(cfg, item.path)
+    messages := buildAIMessages(system, b.String(), aiRepoContext(item.name, m.ccRoot), nil)
+    cmd := func() tea.Msg {
+        draft, err := callAIBackend(cfg, messages)
+        return scaffoldDraftMsg{path: target, draft: draft, err: err}
+    }
+    return m, tea.Batch(cmd, m.aiSpinner.Tick)
+}
+
+// writeScaffold saves a confirmed AI draft to path, which must not exist
+// yet, and shows it.
+func (m model) writeScaffold(path, content string) model {
+    f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+    if err != nil {
+        m.setError("Not written", err)
+        return m
+    }
+    _, err = f.WriteString(content)
+    if cerr := f.Close(); err == nil {
+        err = cerr
+    }
+    if err != nil {
+        m.setError("Write "+path, err)
+        return m
+    }
+    m.appendAI("[wrote " + path + "]")
+    return m.loadDocFile(path)
+}
+
+// confirmAction is an action waiting for a yes/no answer in the
+// confirmation overlay.
+type confirmAction struct {
+    prompt string
+    run    func(model) (model, tea.Cmd)
+    // cancel, if set, runs when the answer is no.
+    cancel func(model) model
+}
+
+// askConfirm stores run as the pending action and shows prompt in the
+// confirmation overlay. Actions that change files go through here so a
+// stray key never writes anything; run is called only on y.
+func (m model) askConfirm(prompt string, run func(model) (model, tea.Cmd)) model {
+    m.confirm = &confirmAction{prompt: prompt, run: run}
+    m.statusMsg = prompt + " (y/n)"
+    m.statusError = ""
+    return m
+}
+
+// updateConfirm answers the confirmation overlay: y runs the pending
+// action, n or Esc drops it. Other keys are swallowed so the prompt is
+// not dismissed by accident; Ctrl+C still quits.
+func (m model) updateConfirm(msg tea.KeyMsg) (model, tea.Cmd) {
+    c := m.confirm
+    switch msg.String() {
+    case "y", "Y":
+        m.confirm = nil
+        m.statusMsg = ""
+        return c.run(m)
+    case "n", "N", "esc":
+        m.confirm = nil
+        m.statusMsg = "Cancelled"
+        if c.cancel != nil {
+            m = c.cancel(m)
+        }
+    case "ctrl+c":
+        m.saveState()
+        return m, tea.Quit
+    }
+    return m, nil
+}
+
+// confirmView renders the confirmation overlay box.
+func (m model) confirmView() string {
+    width := 56
+    if m.width-4 < width {
+        width = m.width - 4
+    }
+    return lipgloss.NewStyle().
+        Border(lipgloss.RoundedBorder()).
+        BorderForeground(m.errorStyle.GetForeground()).
+        Padding(1, 2).
+        Width(width).
+        Render(m.confirm.prompt + "\n\n" + m.statusStyle.Render("y: yes   n / esc: no"))
+}
+
+// overlay draws box over the centre of bg, leaving the rest of bg
+// visible. Both may contain ANSI styling.
+func overlay(bg, box string) string {
+    rows := strings.Split(bg, "\n")
+    lines := strings.Split(box, "\n")
+    top := (len(rows) - len(lines)) / 2
+    left := (lipgloss.Width(bg) - lipgloss.Width(box)) / 2
+    if top < 0 {
+        top = 0
+    }
+    if left < 0 {
+        left = 0
+    }
+    for i, line := range lines {
+        y := top + i
+        if y >= len(rows) {
+            break
+        }
+        row := rows[y]
+        if w := ansi.StringWidth(row); w < left {
+            row += strings.Repeat(" ", left-w)
+        }
+        // Reset before the box so styling open in the row does not
+        // bleed into it.
+        rows[y] = ansi.Truncate(row, left, "") + "\x1b[0m" + line + ansi.TruncateLeft(row, left+ansi.StringWidth(line), "")
+    }
+    return strings.Join(rows, "\n")
+}
+
+// executeCommand runs a command
+
+// executeCommand runs a command from the command palette.
+func (m model) executeCommand(cmdStr string) (model, tea.Cmd) {
+    if cmdStr == "" {
+        return m, nil
+    }
+
+    lower := strings.ToLower(cmdStr)
+
+    switch {
+    case lower == "validate":
+        m = m.runValidation()
+        m.statusMsg = "Validation complete via command."
+
+    case strings.HasPrefix(lower, "open "):
+        arg := strings.TrimSpace(cmdStr[5:])
+        filename := mapDocAliasToFilename(m.cfg.Docs, arg)
+        if filename == "" {
+            m.statusError = "Unknown doc alias: " + arg
+            return m, nil
+        }
+        m = m.loadSelectedRepoFile(filename)
+
+    case lower == "summarize":
+        return m.summarizeRepo()
+
+    case lower == "ai-file" || strings.HasPrefix(lower, "ai-file "):
+        return m.submitPromptFile(strings.TrimSpace(cmdStr[len("ai-file"):]))
+
+    case lower == "clear":
+        m = m.confirmClearAI()
+
+    case lower == "context":
+        m = m.showAIContext()
+
+    case lower == "split" || strings.HasPrefix(lower, "split "):
+        m = m.openSplit(strings.TrimSpace(cmdStr[len("split"):]))
+
+    case lower == "unsplit":
+        if m.split {
+            m = m.closeSplit()
+        }
+
+    case lower == "pull":
+        return m.startPull()
+
+    case lower == "refresh":
+        return m.refreshRepos()
+
+    case lower == "sort" || strings.HasPrefix(lower, "sort "):
+        return m.setSortKey(strings.TrimSpace(lower[len("sort"):]))
+
+    case strings.HasPrefix(lower, "new-repo "):
+        return m.startNewRepo(strings.Fields(cmdStr[len("new-repo "):]))
+
+    case strings.HasPrefix(lower, "diff "):
+        m = m.diffDocs(strings.Fields(cmdStr[5:]))
+
+    case strings.HasPrefix(lower, "ai-scaffold "):
+        return m.startScaffold(strings.TrimSpace(cmdStr[len("ai-scaffold "):]))
+
+    case lower == "grep" || strings.HasPrefix(lower, "grep "):
+        return m.startGrep(strings.TrimSpace(cmdStr[4:]))
+
+    case lower == "temp" || strings.HasPrefix(lower, "temp "):
+        m = m.setTemperature(strings.TrimSpace(lower[4:]))
+
+    case lower == "max-tokens" || strings.HasPrefix(lower, "max-tokens "):
+        m = m.setMaxTokens(strings.TrimSpace(lower[len("max-tokens"):]))
+
+    case strings.HasPrefix(lower, "model "):
+        name := strings.TrimSpace(cmdStr[6:])
+        m = m.setModel(name)
+        if !containsString(m.manualModels, name) {
+            m.manualModels = append(m.manualModels, name)
+            m = m.refreshModelPicker()
+        }
+
+    case strings.HasPrefix(lower, "layout "):
+        arg := strings.TrimSpace(lower[7:])
+        switch arg {
+        case "default":
+            m.profile = profileDefault
+        case "infra":
+            m.profile = profileInfra
+        case "agents":
+            m.profile = profileAgents
+        default:
+            m.statusError = "Unknown layout: " + arg
+            return m, nil
+        }
+        m = m.applyProfileFilter()
+        m.statusMsg = "Layout changed via command."
+
+    default:
+        m.statusError = "Unknown command: " + cmdStr
+    }
+
+    return m, nil
+}
+
+// openModelPicker shows the model picker in the main pane. The backend's
+// model list is fetched the first time only; later opens reuse the cache.
+func (m model) openModelPicker() (model, tea.Cmd) {
+    m.pickingModel = true
+    m = m.refreshModelPicker()
+
+    name, _, hasKey := m.cfg.AI.active()
+    switch {
+    case !hasKey:
+        m.statusMsg = "No AI API key set – showing configured models only"
+        return m, nil
+    case m.modelsFetched || m.modelsLoading:
+        m.statusMsg = "Pick a model: enter to select, / to filter, esc to cancel"
+        return m, nil
+    }
+
+    m.modelsLoading = true
+    m.statusMsg = fmt.Sprintf("Fetching %s models...", name)
+    m.statusError = ""
+    return m, fetchModelsCmd(m.cfg.AI)
+}
+
+// updateModelPicker handles keys while the model picker is open.
+func (m model) updateModelPicker(msg tea.KeyMsg) (model, tea.Cmd) {
+    if m.modelPicker.FilterState() != list.Filtering {
+        switch msg.String() {
+        case "esc":
+            if m.modelPicker.FilterState() == list.FilterApplied {
+                m.modelPicker.ResetFilter()
+                return m, nil
+            }
+            m.pickingModel = false
+            m.statusMsg = "Model selection cancelled"
+            return m, nil
+        case "enter":
+            if item, ok := m.modelPicker.SelectedItem().(modelItem); ok {
+                m = m.setModel(item.id)
+            }
+            m.pickingModel = false
+            return m, nil
+        case "ctrl+c":
+            m.saveState()
+            return m, tea.Quit
+        }
+    }
+
+    var cmd tea.Cmd
+    m.modelPicker, cmd = m.modelPicker.Update(msg)
+    return m, cmd
+}
+
+// refreshModelPicker rebuilds the picker items from the configured,
+// manually entered and fetched models, marking the current one.
+func (m model) refreshModelPicker() model {
+    _, backend, _ := m.cfg.AI.active()
+
+    seen := map[string]bool{}
+    var items []list.Item
+    add := func(it modelItem) {
+        if it.id == "" || seen[it.id] {
+            return
+        }
+        seen[it.id] = true
+        if it.id == backend.Model {
+            it.desc = strings.TrimSpace("(current) " + it.desc)
+        }
+        items = append(items, it)
     }
 
-    footer := status
-    if m.commandMode {
-        footer = m.commandInput.View() + "
-" + status
+    add(modelItem{id: backend.Model, desc: "configured"})
+    for _, name := range m.manualModels {
+        add(modelItem{id: name, desc: "manual"})
+    }
+    for _, it := range m.fetchedModels {
+        add(it)
     }
 
-    return lipgloss.JoinVertical(lipgloss.Left, layout, footer)
+    m.modelPicker.SetItems(items)
+    return m
 }
 
-// resizePanes recalculates pane sizes when window or AI toggle changes.
-func (m model) resizePanes() model {
-    if m.width <= 0 || m.height <= 0 {
+// setModel switches the active backend to the named model for this session.
+func (m model) setModel(name string) model {
+    if name == "" {
+        m.statusError = "Model name is empty"
         return m
     }
+    backendName, backend, _ := m.cfg.AI.active()
+    backend.Model = name
+    m.aiLabel = m.cfg.AI.label()
+    m.statusMsg = fmt.Sprintf("AI model (%s): %s", backendName, name)
+    m.statusError = ""
+    return m
+}
 
-    height := m.height - 1
-    if height < 5 {
-        height = m.height
+// setTemperature handles ":temp <0-2|default>" for the active backend.
+// With no argument it reports the current value.
+func (m model) setTemperature(arg string) model {
+    name, backend, _ := m.cfg.AI.active()
+    switch arg {
+    case "":
+        m.statusMsg = fmt.Sprintf("%s temperature: %s", name, formatOptFloat(backend.Temperature))
+        return m
+    case "default", "off":
+        backend.Temperature = nil
+    default:
+        t, err := strconv.ParseFloat(arg, 64)
+        if err != nil || t < 0 || t > 2 {
+            m.statusError = "Temperature must be between 0 and 2 (or \"default\")"
+            return m
+        }
+        backend.Temperature = &t
     }
+    m.statusMsg = fmt.Sprintf("%s temperature: %s", name, formatOptFloat(backend.Temperature))
+    m.statusError = ""
+    return m
+}
 
-    var repoWidth, mainWidth, aiWidth int
-    if m.showAIPane {
-        repoWidth = int(float64(m.width) * 0.2)
-        aiWidth = int(float64(m.width) * 0.25)
-        mainWidth = m.width - repoWidth - aiWidth
-    } else {
-        repoWidth = int(float64(m.width) * 0.25)
-        mainWidth = m.width - repoWidth
-        aiWidth = 0
+// setMaxTokens handles ":max-tokens <n|default>" for the active backend.
+func (m model) setMaxTokens(arg string) model {
+    name, backend, _ := m.cfg.AI.active()
+    switch arg {
+    case "":
+    case "default", "off":
+        backend.MaxTokens = nil
+    default:
+        n, err := strconv.Atoi(arg)
+        if err != nil || n <= 0 {
+            m.statusError = "max-tokens must be a positive integer (or \"default\")"
+            return m
+        }
+        backend.MaxTokens = &n
+    }
+    limit := "default"
+    if backend.MaxTokens != nil {
+        limit = strconv.Itoa(*backend.MaxTokens)
     }
+    m.statusMsg = fmt.Sprintf("%s max tokens: %s", name, limit)
+    m.statusError = ""
+    return m
+}
 
-    if repoWidth < 20 {
-        repoWidth = 20
+func formatOptFloat(f *float64) string {
+    if f == nil {
+        return "default"
     }
-    if mainWidth < 20 {
-        mainWidth = 20
+    return strconv.FormatFloat(*f, 'g', -1, 64)
+}
+
+func containsString(list []string, s string) bool {
+    for _, v := range list {
+        if v == s {
+            return true
+        }
     }
+    return false
+}
 
-    m.repos.SetSize(repoWidth-4, height-2)
-    m.mainView.Width = mainWidth - 4
-    m.mainView.Height = height - 2
+// Limits for :grep output and concurrency.
+const (
+    grepMaxPerFile = 5
+    grepMaxHits    = 500
+    grepWorkers    = 8
+)
 
-    if m.showAIPane {
-        m.aiView.Width = aiWidth - 4
-        m.aiView.Height = height - 4
-    } else {
-        m.aiView.Width = 0
-        m.aiView.Height = 0
+// startGrep parses ":grep [-a] <regex>" and launches the search.
+func (m model) startGrep(args string) (model, tea.Cmd) {
+    allMarkdown := false
+    if rest, ok := strings.CutPrefix(args, "-a "); ok {
+        allMarkdown = true
+        args = strings.TrimSpace(rest)
+    }
+    if args == "" {
+        m.statusError = "Usage: grep [-a] <regex>"
+        return m, nil
+    }
+    re, err := regexp.Compile(args)
+    if err != nil {
+        m.statusError = fmt.Sprintf("Bad pattern: %v", err)
+        return m, nil
+    }
+    if m.grepRunning {
+        m.statusError = "A search is already running"
+        return m, nil
     }
 
-    return m
+    var repos []repoItem
+    for _, it := range m.allRepos {
+        if r, ok := it.(repoItem); ok {
+            repos = append(repos, r)
+        }
+    }
+
+    m.grepRunning = true
+    m.statusMsg = fmt.Sprintf("Searching %d repos for %q...", len(repos), args)
+    m.statusError = ""
+    return m, grepReposCmd(repos, m.requiredDocs, allMarkdown, re)
 }
 
-func (m model) activePaneLabel() string {
-    switch m.activePane {
-    case paneRepos:
-        return "Repos"
-    case paneMain:
-        return "Main"
-    case paneAI:
-        return "AI"
-    default:
-        return "Unknown"
+// grepReposCmd searches the repos on a bounded pool of workers, one repo
+// per job. Each file contributes at most grepMaxPerFile hits.
+func grepReposCmd(repos []repoItem, docs []string, allMarkdown bool, re *regexp.Regexp) tea.Cmd {
+    return func() tea.Msg {
+        jobs := make(chan repoItem)
+        type result struct {
+            hits  []grepHit
+            files int
+        }
+        results := make(chan result)
+
+        workers := grepWorkers
+        if workers > len(repos) {
+            workers = len(repos)
+        }
+        var wg sync.WaitGroup
+        for i := 0; i < workers; i++ {
+            wg.Add(1)
+            go func() {
+                defer wg.Done()
+                for repo := range jobs {
+                    var r result
+                    for _, path := range grepFiles(repo.path, docs, allMarkdown) {
+                        hits := grepFile(repo, path, re)
+                        r.files++
+                        r.hits = append(r.hits, hits...)
+                    }
+                    results <- r
+                }
+            }()
+        }
+        go func() {
+            for _, repo := range repos {
+                jobs <- repo
+            }
+            close(jobs)
+            wg.Wait()
+            close(results)
+        }()
+
+        msg := grepResultsMsg{pattern: re.String()}
+        for r := range results {
+            msg.files += r.files
+            msg.hits = append(msg.hits, r.hits...)
+        }
+        sort.Slice(msg.hits, func(i, j int) bool {
+            a, b := msg.hits[i], msg.hits[j]
+            if a.repo != b.repo {
+                return a.repo < b.repo
+            }
+            if a.rel != b.rel {
+                return a.rel < b.rel
+            }
+            return a.line < b.line
+        })
+        if len(msg.hits) > grepMaxHits {
+            msg.hits = msg.hits[:grepMaxHits]
+        }
+        return msg
     }
 }
 
-func (m model) profileLabel() string {
-    switch m.profile {
-    case profileDefault:
-        return "default"
-    case profileInfra:
-        return "infra"
-    case profileAgents:
-        return "agents"
-    default:
-        return "unknown"
+// grepFiles lists the files to search in one repo: the required docs that
+// exist, or every .md file outside VCS and dependency directories.
+func grepFiles(root string, docs []string, allMarkdown bool) []string {
+    var files []string
+    if !allMarkdown {
+        for _, doc := range docs {
+            p := filepath.Join(root, doc)
+            if info, err := os.Stat(p); err == nil && info.Mode().IsRegular() {
+                files = append(files, p)
+            }
+        }
+        return files
     }
+
+    filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+        if err != nil {
+            return nil
+        }
+        if d.IsDir() {
+            switch d.Name() {
+            case ".git", "node_modules", "vendor":
+                return filepath.SkipDir
+            }
+            return nil
+        }
+        if strings.EqualFold(filepath.Ext(path), ".md") {
+            files = append(files, path)
+        }
+        return nil
+    })
+    return files
 }
 
-// applyProfileFilter filters the repo list based on the active layout profile.
-func (m model) applyProfileFilter() model {
-    if len(m.allRepos) == 0 {
-        return m
+// grepFile returns up to grepMaxPerFile matching lines of path.
+func grepFile(repo repoItem, path string, re *regexp.Regexp) []grepHit {
+    f, err := os.Open(path)
+    if err != nil {
+        return nil
     }
+    defer f.Close()
 
-    var filtered []list.Item
+    rel, err := filepath.Rel(repo.path, path)
+    if err != nil {
+        rel = filepath.Base(path)
+    }
 
-    switch m.profile {
-    case profileInfra:
-        for _, it := range m.allRepos {
-            if r, ok := it.(repoItem); ok {
-                name := strings.ToLower(r.name)
-                if strings.Contains(name, "infra") || strings.Contains(name, "cloudcurio-infra") {
-                    filtered = append(filtered, it)
-                }
-            }
+    var hits []grepHit
+    sc := bufio.NewScanner(f)
+    sc.Buffer(make([]byte, 64*1024), 1024*1024)
+    for line := 1; sc.Scan(); line++ {
+        if !re.Match(sc.Bytes()) {
+            continue
         }
-    case profileAgents:
-        for _, it := range m.allRepos {
-            if r, ok := it.(repoItem); ok {
-                name := strings.ToLower(r.name)
-                if strings.Contains(name, "agent") || strings.Contains(name, "agents") {
-                    filtered = append(filtered, it)
-                }
-            }
+        hits = append(hits, grepHit{
+            repo: repo.name,
+            path: path,
+            rel:  rel,
+            line: line,
+            text: strings.TrimSpace(sc.Text()),
+        })
+        if len(hits) >= grepMaxPerFile {
+            break
         }
-    default:
-        filtered = m.allRepos
     }
+    return hits
+}
 
-    // Fallback: if filter produced no results, show all.
-    if len(filtered) == 0 {
-        filtered = m.allRepos
+// updateGrepList handles keys while the grep results are shown.
+func (m model) updateGrepList(msg tea.KeyMsg) (model, tea.Cmd) {
+    if m.grepList.FilterState() != list.Filtering {
+        switch msg.String() {
+        case "esc":
+            if m.grepList.FilterState() == list.FilterApplied {
+                m.grepList.ResetFilter()
+                return m, nil
+            }
+            m.showingGrep = false
+            m.statusMsg = "Search closed"
+            return m, nil
+        case "enter":
+            if hit, ok := m.grepList.SelectedItem().(grepHit); ok {
+                m.showingGrep = false
+                m = m.selectRepoNamed(hit.repo)
+                m = m.loadDocFile(hit.path)
+                m = m.scrollToMatch(hit)
+                m, _ = m.focusPane(paneMain)
+            }
+            return m, nil
+        case "ctrl+c":
+            m.saveState()
+            return m, tea.Quit
+        }
     }
 
-    m.repos.SetItems(filtered)
-    return m
+    var cmd tea.Cmd
+    m.grepList, cmd = m.grepList.Update(msg)
+    return m, cmd
 }
 
-// loadSelectedRepoFile reads the given filename for the selected repo and
-// renders it into the main viewport.
-func (m model) loadSelectedRepoFile(filename string) model {
-    item, ok := m.repos.SelectedItem().(repoItem)
-    if !ok {
-        m.statusError = "No repo selected"
-        return m
+// selectRepoNamed selects the named repo in the repo list if it is visible.
+func (m model) selectRepoNamed(name string) model {
+    for i, it := range m.repos.Items() {
+        if r, ok := it.(repoItem); ok && r.name == name {
+            m.repos.Select(i)
+            break
+        }
     }
+    return m
+}
 
-    targetPath := filepath.Join(item.path, filename)
-    data, err := os.ReadFile(targetPath)
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+
+// scrollToMatch scrolls the main view to the rendered line showing hit.
+// Rendering reflows markdown, so the hit's text is looked up in the
+// rendered output; if wrapping split it, the source line's relative
+// position is used instead.
+func (m model) scrollToMatch(hit grepHit) model {
+    content, _, err := m.renderDoc(hit.path) // served from mdCache
     if err != nil {
-        m.mainView.SetContent(fmt.Sprintf("Error reading %s:
-%v", targetPath, err))
-        m.statusError = fmt.Sprintf("Failed to load %s", filename)
         return m
     }
+    rendered := strings.Split(ansiEscape.ReplaceAllString(content, ""), "\n")
+    needle := strings.TrimLeft(hit.text, "#>-*+ ")
+    if len(needle) > 40 {
+        needle = needle[:40]
+    }
+    if needle != "" {
+        for i, line := range rendered {
+            if strings.Contains(line, needle) {
+                m.mainView.SetYOffset(i)
+                return m
+            }
+        }
+    }
 
-    content := string(data)
-    if m.mdRenderer != nil && strings.HasSuffix(strings.ToLower(filename), ".md") {
-        if rendered, err := m.mdRenderer.Render(content); err == nil {
-            content = rendered
+    if data, err := os.ReadFile(hit.path); err == nil {
+        total := bytes.Count(data, []byte("\n")) + 1
+        m.mainView.SetYOffset(hit.line * len(rendered) / total)
+    }
+    return m
+}
+
+// mapDocAliasToFilename maps an alias, shortcut key or file name from docs
+// to the doc's filename, or "" if no doc matches.
+func mapDocAliasToFilename(docs []DocShortcut, alias string) string {
+    alias = strings.ToLower(strings.TrimSpace(alias))
+    for _, d := range docs {
+        if d.matches(alias) {
+            return d.File
         }
     }
+    return ""
+}
 
-    m.mainView.SetContent(content)
+// runValidation renders the validation report into the main pane and
+// records any failures for the error pane.
+func (m model) runValidation() model {
+    m.validating = true
+    report, failures := m.validateRepos()
+    m.mainView.SetContent(report)
     m.mainView.GotoTop()
-    m.statusMsg = fmt.Sprintf("Loaded %s", targetPath)
+    m.currentDocPath = ""
+    m.validating = false
+
     m.statusError = ""
+    if len(failures) > 0 {
+        m.setError(fmt.Sprintf("Validation: %d repos missing docs", len(failures)),
+            errors.New(strings.Join(failures, "\n")))
+    }
     return m
 }
 
-// appendAI appends a line to the AI viewport.
-func (m *model) appendAI(line string) {
-    current := m.aiView.View()
-    if strings.TrimSpace(current) == "" {
-        m.aiView.SetContent(line)
-    } else {
-        m.aiView.SetContent(current + "
-" + line)
+// missingDocs returns the entries of required that do not exist in
+// repoPath, never nil.
+func missingDocs(repoPath string, required []string) []string {
+    missing := []string{}
+    for _, doc := range required {
+        if _, err := os.Stat(filepath.Join(repoPath, doc)); err != nil {
+            missing = append(missing, doc)
+        }
     }
-    m.aiView.GotoBottom()
+    return missing
 }
 
-// handleAISubmit collects the prompt, appends it to the AI view, and triggers
-// an async AI call via tea.Cmd.
-func (m model) handleAISubmit(cmds []tea.Cmd) (model, []tea.Cmd) {
-    prompt := strings.TrimSpace(m.aiInput.Value())
-    if prompt == "" {
-        return m, cmds
+// validateRepos checks each repo for the required docs and returns a report
+// and one "repo: missing, docs" line per failing repo.
+func (m model) validateRepos() (string, []string) {
+    var b strings.Builder
+    b.WriteString("CloudCurio Repo Validation Report\n")
+    b.WriteString(time.Now().Format(time.RFC3339) + "\n\n")
+
+    items := m.allRepos
+    if len(items) == 0 {
+        b.WriteString("No repositories found under CC_ROOT.\n")
+        return b.String(), nil
     }
 
-    item, _ := m.repos.SelectedItem().(repoItem)
-    repoName := item.name
+    anyMissing := false
+    var failures []string
+    for _, it := range items {
+        repo, ok := it.(repoItem)
+        if !ok {
+            continue
+        }
+        b.WriteString(fmt.Sprintf("Repo: %s\n", repo.name))
 
-    m.appendAI("You: " + prompt)
-    m.aiInput.SetValue("")
-    m.aiLoading = true
-    m.statusMsg = "Sending prompt to AI backend..."
+        missing := missingDocs(repo.path, m.requiredDocs)
+
+        anyMissing = anyMissing || len(missing) > 0
+        if len(missing) > 0 {
+            failures = append(failures, repo.name+": "+strings.Join(missing, ", "))
+        }
+        if len(missing) == 0 {
+            b.WriteString("  ✓ All required docs present.\n\n")
+        } else {
+            b.WriteString("  ✗ Missing docs:\n")
+            for _, doc := range missing {
+                b.WriteString("    - " + doc + "\n")
+            }
+            b.WriteString("\n")
+        }
+    }
 
-    cmd := aiRequestCmd(prompt, repoName, m.ccRoot)
-    cmds = append(cmds, cmd)
+    if anyMissing {
+        b.WriteString("Tip: select a repo and run :ai-scaffold <doc> to draft a missing doc with AI.\n")
+    }
 
-    return m, cmds
+    return b.String(), failures
 }
 
-// executeCommand runs a command from the command palette.
-func (m model) executeCommand(cmdStr string) model {
-    if cmdStr == "" {
-        return m
+// ---------------------------------------------------------------------
+// AI Backend Integration
+// ---------------------------------------------------------------------
+
+// aiSystemPrompt is the system message sent when neither the repo nor the
+// config provides one.
+const aiSystemPrompt = "You are a helpful assistant for the CloudCurio project. Use the provided repo context when helpful."
+
+// aiSystemFile is the per-repo file that overrides the system prompt, so a
+// project can set the assistant's persona and rules.
+const aiSystemFile = ".cc-ai-system.md"
+
+// systemPromptFor returns the system message for requests about the repo
+// at repoPath and where it came from: the repo's aiSystemFile, then
+// ai.system_prompt, then aiSystemPrompt. Empty or unreadable files are
+// skipped (the latter with a warning in the log).
+func systemPromptFor(cfg AIConfig, repoPath string) (string, string) {
+    if repoPath != "" {
+        data, err := os.ReadFile(filepath.Join(repoPath, aiSystemFile))
+        switch {
+        case err == nil && strings.TrimSpace(string(data)) != "":
+            return strings.TrimSpace(string(data)), aiSystemFile
+        case err != nil && !os.IsNotExist(err):
+            slog.Warn("cannot read repo system prompt", "repo", repoPath, "err", err)
+        }
     }
+    if s := strings.TrimSpace(cfg.SystemPrompt); s != "" {
+        return s, "ai.system_prompt"
+    }
+    return aiSystemPrompt, "default"
+}
 
-    lower := strings.ToLower(cmdStr)
+// aiRepoContext describes the selected repo for the AI backend.
+func aiRepoContext(repoName, ccRoot string) string {
+    return fmt.Sprintf("Repo: %s\nCC_ROOT: %s", repoName, ccRoot)
+}
 
-    switch {
-    case lower == "validate":
-        m.validating = true
-        report := m.validateRepos()
-        m.mainView.SetContent(report)
-        m.mainView.GotoTop()
-        m.validating = false
-        m.statusMsg = "Validation complete via command."
+// retrievalMaxDocs is how many docs are attached to an AI question, and
+// retrievalCharBudget caps their combined text (~2k tokens).
+const (
+    retrievalMaxDocs    = 2
+    retrievalCharBudget = 8000
+)
 
-    case strings.HasPrefix(lower, "open "):
-        arg := strings.TrimSpace(cmdStr[5:])
-        filename := mapDocAliasToFilename(arg)
-        if filename == "" {
-            m.statusError = "Unknown doc alias: " + arg
-            return m
+// retrievalStopWords are dropped from questions and docs before scoring.
+var retrievalStopWords = map[string]bool{
+    "the": true, "and": true, "for": true, "are": true, "but": true,
+    "not": true, "you": true, "all": true, "can": true, "was": true,
+    "our": true, "has": true, "have": true, "this": true, "that": true,
+    "with": true, "from": true, "what": true, "which": true, "when": true,
+    "where": true, "how": true, "why": true, "who": true, "does": true,
+    "there": true, "their": true, "they": true, "them": true, "about": true,
+    "into": true, "your": true, "will": true, "would": true, "should": true,
+    "could": true, "any": true, "some": true, "than": true, "then": true,
+    "its": true, "use": true, "also": true, "just": true, "only": true,
+}
+
+// retrievalTerms lowercases text and splits it into words of at least three
+// letters or digits, leaving out stop words.
+func retrievalTerms(text string) []string {
+    words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+        return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+    })
+    terms := words[:0]
+    for _, w := range words {
+        if len([]rune(w)) >= 3 && !retrievalStopWords[w] {
+            terms = append(terms, w)
         }
-        m = m.loadSelectedRepoFile(filename)
+    }
+    return terms
+}
 
-    case strings.HasPrefix(lower, "layout "):
-        arg := strings.TrimSpace(lower[7:])
-        switch arg {
-        case "default":
-            m.profile = profileDefault
-        case "infra":
-            m.profile = profileInfra
-        case "agents":
-            m.profile = profileAgents
-        default:
-            m.statusError = "Unknown layout: " + arg
-            return m
+// relevantDocs scores the docs that exist in repo against question with
+// TF-IDF and returns up to max of them, best first. A doc's file name
+// counts as part of its text, so a question about "tasks" favours
+// TASKS.md. Docs sharing no term with the question are never picked.
+func relevantDocs(repo repoItem, docs []string, question string, max int) []string {
+    query := map[string]bool{}
+    for _, t := range retrievalTerms(question) {
+        query[t] = true
+    }
+    if len(query) == 0 || max <= 0 {
+        return nil
+    }
+
+    type candidate struct {
+        doc   string
+        tf    map[string]float64
+        score float64
+    }
+    var cands []candidate
+    df := map[string]int{}
+    for _, doc := range docs {
+        data, err := os.ReadFile(filepath.Join(repo.path, doc))
+        if err != nil {
+            continue
+        }
+        terms := retrievalTerms(strings.TrimSuffix(doc, filepath.Ext(doc)) + " " + string(data))
+        if len(terms) == 0 {
+            continue
+        }
+        tf := map[string]float64{}
+        for _, t := range terms {
+            tf[t]++
+        }
+        for t := range tf {
+            df[t]++
+            tf[t] /= float64(len(terms))
+        }
+        cands = append(cands, candidate{doc: doc, tf: tf})
+    }
+
+    for i := range cands {
+        for t := range query {
+            if tf := cands[i].tf[t]; tf > 0 {
+                cands[i].score += tf * math.Log(1+float64(len(cands))/float64(df[t]))
+            }
+        }
+    }
+    sort.SliceStable(cands, func(i, j int) bool { return cands[i].score > cands[j].score })
+
+    var picked []string
+    for _, c := range cands {
+        if c.score <= 0 || len(picked) == max {
+            break
         }
-        m = m.applyProfileFilter()
-        m.statusMsg = "Layout changed via command."
+        picked = append(picked, c.doc)
+    }
+    return picked
+}
 
-    default:
-        m.statusError = "Unknown command: " + cmdStr
+// aiQuestionContext builds the context message for a typed AI question:
+// the repo line plus the selected repo's docs that relevantDocs picks for
+// prompt. The picked doc names are returned for the status line.
+func (m model) aiQuestionContext(prompt string) (string, []string) {
+    item, ok := m.repos.SelectedItem().(repoItem)
+    if !ok {
+        return aiRepoContext("", m.ccRoot), nil
     }
+    context := aiRepoContext(item.name, m.ccRoot)
+    picked := relevantDocs(item, m.requiredDocs, prompt, retrievalMaxDocs)
+    if len(picked) == 0 {
+        return context, nil
+    }
+    sections, found, _ := readRepoDocs(item, picked, retrievalCharBudget)
+    return context + "\n" + sections, found
+}
 
-    return m
+// pickedDocsLabel describes the docs attached to a question for the status
+// line.
+func pickedDocsLabel(picked []string) string {
+    if len(picked) == 0 {
+        return "no matching docs"
+    }
+    return "context: " + strings.Join(picked, ", ")
 }
 
-// mapDocAliasToFilename maps simple aliases to actual doc filenames.
-func mapDocAliasToFilename(alias string) string {
-    alias = strings.ToLower(strings.TrimSpace(alias))
-    switch alias {
-    case "summary", "project", "project_summary", "s":
-        return "PROJECT_SUMMARY.md"
-    case "rules", "r":
-        return "RULES.md"
-    case "agents", "g":
-        return "AGENTS.md"
-    case "instructions", "i":
-        return "INSTRUCTIONS.md"
-    case "journal", "j":
-        return "JOURNAL.md"
-    case "srs", "k":
-        return "SRS.md"
-    case "tasks", "t":
-        return "TASKS.md"
-    case "testing", "test", "y":
-        return "TESTING.md"
+// buildAIMessages assembles the chat messages sent for prompt, with system
+// from systemPromptFor and the earlier turns in history between the context
+// and the prompt. Every backend is sent messages built here. It has no side
+// effects, so ":context" can show exactly what a request would send.
+func buildAIMessages(system, prompt, context string, history []chatTurn) []openAIChatMessage {
+    messages := []openAIChatMessage{
+        {Role: "system", Content: system},
+        {Role: "user", Content: "Context:\n" + context},
+    }
+    for _, t := range history {
+        messages = append(messages, openAIChatMessage{Role: t.Role, Content: t.Text})
+    }
+    return append(messages, openAIChatMessage{Role: "user", Content: prompt})
+}
+
+// notifyModes are the accepted ai.notify / CC_AI_NOTIFY values; "" is off.
+var notifyModes = []string{"", "off", "bell", "osc9"}
+
+// notifyCmd writes a bell or OSC 9 notification for text to out, the
+// program's own terminal, so it reaches SSH clients too. Inside tmux the
+// OSC sequence is wrapped in a DCS passthrough (tmux relays bells itself).
+// It returns nil when notifications are off.
+func notifyCmd(out io.Writer, mode string, tmux bool, text string) tea.Cmd {
+    var seq string
+    switch mode {
+    case "bell":
+        seq = "\a"
+    case "osc9":
+        seq = "\x1b]9;" + strings.Map(func(r rune) rune {
+            if unicode.IsControl(r) {
+                return -1
+            }
+            return r
+        }, text) + "\a"
+        if tmux {
+            seq = "\x1bPtmux;" + strings.ReplaceAll(seq, "\x1b", "\x1b\x1b") + "\x1b\\"
+        }
     default:
-        return ""
+        return nil
+    }
+    return func() tea.Msg {
+        if _, err := io.WriteString(out, seq); err != nil {
+            slog.Warn("cannot write AI notification", "mode", mode, "err", err)
+        }
+        return nil
     }
 }
 
-// validateRepos checks each repo for the required docs and returns a report.
-func (m model) validateRepos() string {
-    var b strings.Builder
-    b.WriteString("CloudCurio Repo Validation Report
-")
-    b.WriteString(time.Now().Format(time.RFC3339) + "
+// aiRequestCmd returns a tea.Cmd that sends messages (see
+// buildAIMessages) to an AI backend asynchronously.
+func aiRequestCmd(cfg AIConfig, messages []openAIChatMessage) tea.Cmd {
+    return func() tea.Msg {
+        resp, err := callAIBackend(cfg, messages)
+        return aiResponseMsg{response: resp, err: err}
+    }
+}
 
-")
+// rateLimiter is a token bucket refilled at perMinute tokens a minute and
+// holding at most perMinute. A nil *rateLimiter allows everything.
+type rateLimiter struct {
+    mu        sync.Mutex
+    perMinute float64
+    tokens    float64
+    last      time.Time
+}
 
-    items := m.allRepos
-    if len(items) == 0 {
-        b.WriteString("No repositories found under CC_ROOT.
-")
-        return b.String()
-    }
+// aiLimiter throttles callAIBackend; main sets it from
+// ai.requests_per_minute and it stays nil (off) by default.
+var aiLimiter *rateLimiter
 
-    for _, it := range items {
-        repo, ok := it.(repoItem)
-        if !ok {
-            continue
-        }
-        b.WriteString(fmt.Sprintf("Repo: %s
-", repo.name))
+// newRateLimiter returns a full bucket of perMinute tokens, or nil when
+// perMinute is 0.
+func newRateLimiter(perMinute int) *rateLimiter {
+    if perMinute <= 0 {
+        return nil
+    }
+    return &rateLimiter{perMinute: float64(perMinute), tokens: float64(perMinute), last: time.Now()}
+}
 
-        missing := []string{}
-        for _, doc := range m.requiredDocs {
-            p := filepath.Join(repo.path, doc)
-            if _, err := os.Stat(p); err != nil {
-                missing = append(missing, doc)
-            }
-        }
+// take spends a token if one is available. Otherwise it reports how long
+// until the next token and spends nothing.
+func (l *rateLimiter) take() (wait time.Duration, ok bool) {
+    if l == nil {
+        return 0, true
+    }
+    l.mu.Lock()
+    defer l.mu.Unlock()
+
+    now := time.Now()
+    l.tokens = min(l.perMinute, l.tokens+now.Sub(l.last).Minutes()*l.perMinute)
+    l.last = now
+    if l.tokens >= 1 {
+        l.tokens--
+        return 0, true
+    }
+    return time.Duration((1 - l.tokens) / l.perMinute * float64(time.Minute)), false
+}
 
-        if len(missing) == 0 {
-            b.WriteString("  ✓ All required docs present.
+// callAIBackend chooses between OpenAI, OpenRouter and Gemini based on
+// the AI config (see AIConfig.active).
+// Requests over ai.requests_per_minute are rejected without being sent.
+func callAIBackend(cfg AIConfig, messages []openAIChatMessage) (string, error) {
+    name, backend, ok := cfg.active()
+    if !ok {
+        return "", fmt.Errorf("no AI backend configured (set OPENAI_API_KEY, OPENROUTER_API_KEY or GEMINI_API_KEY)")
+    }
+    if wait, ok := aiLimiter.take(); !ok {
+        secs := int(wait.Seconds()) + 1
+        slog.Warn("AI request rate limited locally", "backend", name, "retry_in", secs)
+        return "", fmt.Errorf("rate limited locally, try again in %ds", secs)
+    }
 
-")
-        } else {
-            b.WriteString("  ✗ Missing docs:
-")
-            for _, doc := range missing {
-                b.WriteString("    - " + doc + "
-")
-            }
-            b.WriteString("
-")
-        }
+    chars := 0
+    for _, msg := range messages {
+        chars += len(msg.Content)
+    }
+    logger := slog.With("backend", name, "model", backend.Model)
+    logger.Debug("AI request", "messages", len(messages), "chars", chars)
+
+    start := time.Now()
+    var resp string
+    var err error
+    switch name {
+    case "openrouter":
+        resp, err = callOpenRouterChat(*backend, messages)
+    case "gemini":
+        resp, err = callGeminiChat(*backend, messages)
+    default:
+        resp, err = callOpenAIChat(*backend, messages)
+    }
+    elapsed := time.Since(start).Round(time.Millisecond)
+    if err != nil {
+        logger.Error("AI request failed", "elapsed", elapsed, "err", err)
+        return "", err
     }
+    logger.Info("AI response", "elapsed", elapsed, "prompt_chars", chars, "response_chars", len(resp))
+    return resp, nil
+}
 
-    return b.String()
+// modelsEndpoints are the model listing URLs for the OpenAI-style
+// backends. Both return {"data": [{"id": ...}, ...]}; OpenRouter adds
+// names and context sizes. Gemini is listed by fetchGeminiModels.
+var modelsEndpoints = map[string]string{
+    "openai":     "https://api.openai.com/v1/models",
+    "openrouter": "https://openrouter.ai/api/v1/models",
 }
 
-// ---------------------------------------------------------------------
-// AI Backend Integration
-// ---------------------------------------------------------------------
+type modelsResponse struct {
+    Data []struct {
+        ID            string `json:"id"`
+        Name          string `json:"name"`
+        OwnedBy       string `json:"owned_by"`
+        ContextLength int    `json:"context_length"`
+    } `json:"data"`
+}
 
-// aiRequestCmd returns a tea.Cmd that calls an AI backend asynchronously.
-func aiRequestCmd(prompt, repoName, ccRoot string) tea.Cmd {
+// fetchModelsCmd returns a tea.Cmd that lists the active backend's models.
+func fetchModelsCmd(cfg AIConfig) tea.Cmd {
     return func() tea.Msg {
-        ctx := fmt.Sprintf("Repo: %s
-CC_ROOT: %s", repoName, ccRoot)
-        resp, err := callAIBackend(prompt, ctx)
-        return aiResponseMsg{response: resp, err: err}
+        name, backend, _ := cfg.active()
+        var models []modelItem
+        var err error
+        if name == "gemini" {
+            models, err = fetchGeminiModels(backend.APIKey)
+        } else {
+            models, err = fetchModels(modelsEndpoints[name], backend.APIKey)
+        }
+        return modelsLoadedMsg{backend: name, models: models, err: err}
     }
 }
 
-// callAIBackend chooses between OpenAI and OpenRouter based on env vars.
-func callAIBackend(prompt, context string) (string, error) {
-    if key := os.Getenv("OPENAI_API_KEY"); key != "" {
-        model := os.Getenv("OPENAI_MODEL")
-        if model == "" {
-            model = "gpt-4.1-mini"
-        }
-        return callOpenAIChat(key, model, prompt, context)
+// fetchModels GETs a /models endpoint and returns the entries sorted by ID.
+func fetchModels(url, apiKey string) ([]modelItem, error) {
+    req, err := http.NewRequest("GET", url, nil)
+    if err != nil {
+        return nil, err
     }
+    req.Header.Set("Authorization", "Bearer "+apiKey)
 
-    if key := os.Getenv("OPENROUTER_API_KEY"); key != "" {
-        model := os.Getenv("OPENROUTER_MODEL")
-        if model == "" {
-            model = "openrouter/auto"
-        }
-        return callOpenRouterChat(key, model, prompt, context)
+    client := &http.Client{Timeout: 30 * time.Second}
+    resp, err := client.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode >= 300 {
+        b, _ := io.ReadAll(resp.Body)
+        return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(b)))
+    }
+
+    var parsed modelsResponse
+    if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+        return nil, err
     }
 
-    return "", fmt.Errorf("no AI backend configured (set OPENAI_API_KEY or OPENROUTER_API_KEY)")
+    models := make([]modelItem, 0, len(parsed.Data))
+    for _, d := range parsed.Data {
+        desc := d.OwnedBy
+        if d.Name != "" {
+            desc = d.Name
+        }
+        if d.ContextLength > 0 {
+            desc = fmt.Sprintf("%s · %dk ctx", desc, d.ContextLength/1000)
+        }
+        models = append(models, modelItem{id: d.ID, desc: desc})
+    }
+    sort.Slice(models, func(i, j int) bool { return models[i].id < models[j].id })
+    return models, nil
 }
 
 // Minimal structs for OpenAI / OpenRouter chat API calls.
@@ -854,8 +5250,10 @@ type openAIChatMessage struct {
 }
 
 type openAIChatRequest struct {
-    Model    string              `json:"model"`
-    Messages []openAIChatMessage `json:"messages"`
+    Model       string              `json:"model"`
+    Messages    []openAIChatMessage `json:"messages"`
+    Temperature *float64            `json:"temperature,omitempty"`
+    MaxTokens   *int                `json:"max_tokens,omitempty"`
 }
 
 type openAIChatChoice struct {
@@ -867,15 +5265,13 @@ type openAIChatResponse struct {
 }
 
 // callOpenAIChat sends a chat completion request to OpenAI.
-func callOpenAIChat(apiKey, model, prompt, context string) (string, error) {
+func callOpenAIChat(backend AIBackendConfig, messages []openAIChatMessage) (string, error) {
+    apiKey := backend.APIKey
     body := openAIChatRequest{
-        Model: model,
-        Messages: []openAIChatMessage{
-            {Role: "system", Content: "You are a helpful assistant for the CloudCurio project. Use the provided repo context when helpful."},
-            {Role: "user", Content: fmt.Sprintf("Context:
-%s", context)},
-            {Role: "user", Content: prompt},
-        },
+        Model:       backend.Model,
+        Temperature: backend.Temperature,
+        MaxTokens:   backend.MaxTokens,
+        Messages:    messages,
     }
 
     data, err := json.Marshal(body)
@@ -919,15 +5315,13 @@ type openRouterChatRequest openAIChatRequest
 
 type openRouterChatResponse openAIChatResponse
 
-func callOpenRouterChat(apiKey, model, prompt, context string) (string, error) {
+func callOpenRouterChat(backend AIBackendConfig, messages []openAIChatMessage) (string, error) {
+    apiKey := backend.APIKey
     body := openRouterChatRequest{
-        Model: model,
-        Messages: []openAIChatMessage{
-            {Role: "system", Content: "You are a helpful assistant for the CloudCurio project. Use the provided repo context when helpful."},
-            {Role: "user", Content: fmt.Sprintf("Context:
-%s", context)},
-            {Role: "user", Content: prompt},
-        },
+        Model:       backend.Model,
+        Temperature: backend.Temperature,
+        MaxTokens:   backend.MaxTokens,
+        Messages:    messages,
     }
 
     data, err := json.Marshal(body)
@@ -967,43 +5361,493 @@ func callOpenRouterChat(apiKey, model, prompt, context string) (string, error) {
     return parsed.Choices[0].Message.Content, nil
 }
 
+// Gemini's generateContent API has its own shape: a system instruction
+// plus "contents" of role/parts turns, where the assistant role is
+// "model".
+
+// geminiAPIBase is the Gemini REST API root.
+const geminiAPIBase = "https://generativelanguage.googleapis.com/v1beta"
+
+type geminiPart struct {
+    Text string `json:"text"`
+}
+
+type geminiContent struct {
+    Role  string       `json:"role,omitempty"`
+    Parts []geminiPart `json:"parts"`
+}
+
+type geminiGenerationConfig struct {
+    Temperature     *float64 `json:"temperature,omitempty"`
+    MaxOutputTokens *int     `json:"maxOutputTokens,omitempty"`
+}
+
+type geminiRequest struct {
+    SystemInstruction *geminiContent          `json:"systemInstruction,omitempty"`
+    Contents          []geminiContent         `json:"contents"`
+    GenerationConfig  *geminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+type geminiResponse struct {
+    Candidates []struct {
+        Content      geminiContent `json:"content"`
+        FinishReason string        `json:"finishReason"`
+    } `json:"candidates"`
+    PromptFeedback struct {
+        BlockReason string `json:"blockReason"`
+    } `json:"promptFeedback"`
+}
+
+// geminiRequestBody maps chat messages onto a generateContent request:
+// system messages become the system instruction, assistant turns the
+// "model" role.
+func geminiRequestBody(backend AIBackendConfig, messages []openAIChatMessage) geminiRequest {
+    var body geminiRequest
+    for _, msg := range messages {
+        switch msg.Role {
+        case "system":
+            if body.SystemInstruction == nil {
+                body.SystemInstruction = &geminiContent{}
+            }
+            body.SystemInstruction.Parts = append(body.SystemInstruction.Parts, geminiPart{Text: msg.Content})
+        case "assistant":
+            body.Contents = append(body.Contents, geminiContent{Role: "model", Parts: []geminiPart{{Text: msg.Content}}})
+        default:
+            body.Contents = append(body.Contents, geminiContent{Role: "user", Parts: []geminiPart{{Text: msg.Content}}})
+        }
+    }
+    if backend.Temperature != nil || backend.MaxTokens != nil {
+        body.GenerationConfig = &geminiGenerationConfig{
+            Temperature:     backend.Temperature,
+            MaxOutputTokens: backend.MaxTokens,
+        }
+    }
+    return body
+}
+
+// callGeminiChat sends a generateContent request to Gemini and joins the
+// text parts of the first candidate.
+func callGeminiChat(backend AIBackendConfig, messages []openAIChatMessage) (string, error) {
+    data, err := json.Marshal(geminiRequestBody(backend, messages))
+    if err != nil {
+        return "", err
+    }
+
+    url := geminiAPIBase + "/models/" + strings.TrimPrefix(backend.Model, "models/") + ":generateContent"
+    req, err := http.NewRequest("POST", url, bytes.NewBuffer(data))
+    if err != nil {
+        return "", err
+    }
+    req.Header.Set("Content-Type", "application/json")
+    req.Header.Set("x-goog-api-key", backend.APIKey)
+
+    client := &http.Client{Timeout: 60 * time.Second}
+    resp, err := client.Do(req)
+    if err != nil {
+        return "", err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode >= 300 {
+        b, _ := io.ReadAll(resp.Body)
+        return "", fmt.Errorf("gemini api error: %s", string(b))
+    }
+
+    var parsed geminiResponse
+    if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+        return "", err
+    }
+    if len(parsed.Candidates) == 0 {
+        if reason := parsed.PromptFeedback.BlockReason; reason != "" {
+            return "", fmt.Errorf("gemini blocked the prompt: %s", reason)
+        }
+        return "", fmt.Errorf("no candidates returned from Gemini")
+    }
+
+    var b strings.Builder
+    for _, part := range parsed.Candidates[0].Content.Parts {
+        b.WriteString(part.Text)
+    }
+    if b.Len() == 0 {
+        return "", fmt.Errorf("empty response from Gemini (finish reason: %s)", parsed.Candidates[0].FinishReason)
+    }
+    return b.String(), nil
+}
+
+// fetchGeminiModels lists the Gemini models that support generateContent,
+// sorted by ID.
+func fetchGeminiModels(apiKey string) ([]modelItem, error) {
+    req, err := http.NewRequest("GET", geminiAPIBase+"/models?pageSize=1000", nil)
+    if err != nil {
+        return nil, err
+    }
+    req.Header.Set("x-goog-api-key", apiKey)
+
+    client := &http.Client{Timeout: 30 * time.Second}
+    resp, err := client.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode >= 300 {
+        b, _ := io.ReadAll(resp.Body)
+        return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(b)))
+    }
+
+    var parsed struct {
+        Models []struct {
+            Name                       string   `json:"name"`
+            DisplayName                string   `json:"displayName"`
+            InputTokenLimit            int      `json:"inputTokenLimit"`
+            SupportedGenerationMethods []string `json:"supportedGenerationMethods"`
+        } `json:"models"`
+    }
+    if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+        return nil, err
+    }
+
+    var models []modelItem
+    for _, d := range parsed.Models {
+        if !containsString(d.SupportedGenerationMethods, "generateContent") {
+            continue
+        }
+        desc := d.DisplayName
+        if d.InputTokenLimit > 0 {
+            desc = fmt.Sprintf("%s · %dk ctx", desc, d.InputTokenLimit/1000)
+        }
+        models = append(models, modelItem{id: strings.TrimPrefix(d.Name, "models/"), desc: desc})
+    }
+    sort.Slice(models, func(i, j int) bool { return models[i].id < models[j].id })
+    return models, nil
+}
+
 // ---------------------------------------------------------------------
 // SSH Server Mode (Wish)
 // ---------------------------------------------------------------------
 
-// runSSHServer starts a Wish-based SSH server that serves the TUI.
-func runSSHServer(ccRoot string) error {
-    addr := os.Getenv("CC_TUI_SSH_ADDR")
-    if addr == "" {
-        addr = ":23234"
+// sshShutdownTimeout is how long runSSHServer waits for open sessions to
+// end after SIGINT or SIGTERM before closing them.
+const sshShutdownTimeout = 30 * time.Second
+
+// runSSHServer starts a Wish-based SSH server that serves the TUI. On
+// SIGINT or SIGTERM it stops accepting connections and gives open sessions
+// sshShutdownTimeout to finish.
+func runSSHServer(cfg Config) error {
+    addr := cfg.SSH.Addr
+    keyPath := cfg.SSH.HostKey
+    authKeysPath := cfg.SSH.AuthorizedKeys
+
+    opts := []ssh.Option{
+        wish.WithAddress(addr),
+        wish.WithHostKeyPath(keyPath),
     }
 
-    keyPath := os.Getenv("CC_TUI_SSH_KEY")
-    if keyPath == "" {
-        home, err := os.UserHomeDir()
-        if err != nil {
-            return fmt.Errorf("could not determine home directory: %w", err)
+    keyAuth := false
+    if _, err := os.Stat(authKeysPath); err == nil {
+        keyAuth = true
+        authKeys := &authorizedKeys{path: authKeysPath}
+        // Parse once up front so bad entries are logged at startup.
+        if _, err := authKeys.load(); err != nil {
+            return fmt.Errorf("read authorized_keys: %w", err)
         }
-        keyPath = filepath.Join(home, ".ssh", "cloudcurio_tui")
+        opts = append(opts, wish.WithPublicKeyAuth(func(ctx ssh.Context, key ssh.PublicKey) bool {
+            return authorizeKey(authKeys, ctx, key)
+        }))
+        slog.Info("SSH public-key auth enabled", "authorized_keys", authKeysPath)
+    } else {
+        slog.Warn("authorized_keys not found; SSH server is OPEN to any client", "authorized_keys", authKeysPath)
+        slog.Warn("create it or set CC_TUI_SSH_AUTHORIZED_KEYS to require public-key auth")
+        slog.Warn("per-user roots are disabled without public-key auth; every session gets CC_ROOT", "cc_root", cfg.Root)
     }
 
-    server, err := wish.NewServer(
-        wish.WithAddress(addr),
-        wish.WithHostKeyPath(keyPath),
+    opts = append(opts,
         wish.WithMiddleware(
             bm.Middleware(func(s ssh.Session) (tea.Model, []tea.ProgramOption) {
-                m := initialModel(ccRoot)
-                return m, []tea.ProgramOption{tea.WithAltScreen()}
+                sessCfg := cfg
+                sessCfg.Root = sessionRoot(cfg, s, keyAuth)
+                m := initialModel(sessCfg)
+                m.sshSession = true
+                m.termOut = s
+                m.termTmux = sessionHasEnv(s, "TMUX")
+                opts := []tea.ProgramOption{tea.WithAltScreen()}
+                if cfg.Mouse {
+                    opts = append(opts, tea.WithMouseCellMotion())
+                }
+                return m, opts
             }),
             wlog.Middleware(),
+            sessionLimitMiddleware(cfg.SSH.MaxSessions),
         ),
     )
+
+    server, err := wish.NewServer(opts...)
     if err != nil {
         return fmt.Errorf("failed to create SSH server: %w", err)
     }
 
-    log.Printf("[cloudcurio-tui] SSH server listening on %s (host key: %s)", addr, keyPath)
-    return server.ListenAndServe()
+    slog.Info("SSH server listening", "addr", addr, "host_key", keyPath)
+
+    stop := make(chan os.Signal, 1)
+    signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+    defer signal.Stop(stop)
+
+    serveErr := make(chan error, 1)
+    go func() { serveErr <- server.ListenAndServe() }()
+
+    select {
+    case err := <-serveErr:
+        return err
+    case sig := <-stop:
+        slog.Info("SSH server shutting down", "signal", sig.String(), "timeout", sshShutdownTimeout)
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), sshShutdownTimeout)
+    defer cancel()
+    if err := server.Shutdown(ctx); err != nil {
+        // Sessions still open after the timeout are cut off.
+        slog.Warn("SSH sessions did not close in time; closing them", "err", err)
+        server.Close()
+        return fmt.Errorf("shut down SSH server: %w", err)
+    }
+    slog.Info("SSH server stopped")
+    return nil
+}
+
+// sshKeyOwnerKey is the ssh.Context key under which authorizeKey stores
+// the owner named by the authorized_keys entry that matched.
+type sshKeyOwnerKey struct{}
+
+// keyOwner returns the account an authorized_keys comment names: the
+// part before any "@", so "alice@laptop" belongs to alice.
+func keyOwner(comment string) string {
+    owner, _, _ := strings.Cut(strings.TrimSpace(comment), "@")
+    return owner
+}
+
+// sessionRoot picks the CC_ROOT for an SSH session. The SSH username is
+// chosen by the client, so the per-user root is used only with public-key
+// auth and only when that name matches the owner of the key that
+// authenticated; otherwise every session gets the global root.
+func sessionRoot(cfg Config, s ssh.Session, keyAuth bool) string {
+    if !keyAuth {
+        return cfg.Root
+    }
+    owner, _ := s.Context().Value(sshKeyOwnerKey{}).(string)
+    if owner != s.User() {
+        slog.Warn("SSH username does not match the key's owner; using CC_ROOT", "user", s.User(), "key_owner", owner, "cc_root", cfg.Root)
+        return cfg.Root
+    }
+    return userRoot(cfg.SSH.RootTemplate, owner, cfg.Root)
+}
+
+// sessionLimitMiddleware counts active SSH sessions, logging each connect
+// and disconnect, and turns sessions away once max are open (0 means no
+// limit). It is the last middleware so it runs before the TUI starts.
+func sessionLimitMiddleware(max int) wish.Middleware {
+    var mu sync.Mutex
+    active := 0
+
+    return func(next ssh.Handler) ssh.Handler {
+        return func(s ssh.Session) {
+            mu.Lock()
+            if max > 0 && active >= max {
+                mu.Unlock()
+                slog.Warn("SSH session rejected: too many sessions", "user", s.User(), "remote", s.RemoteAddr(), "max", max)
+                fmt.Fprintf(s, "cloudcurio-tui is at its limit of %d sessions; please try again in a little while.\r\n", max)
+                s.Exit(1)
+                return
+            }
+            active++
+            n := active
+            mu.Unlock()
+            slog.Info("SSH session opened", "user", s.User(), "remote", s.RemoteAddr(), "active", n)
+
+            defer func() {
+                mu.Lock()
+                active--
+                n := active
+                mu.Unlock()
+                slog.Info("SSH session closed", "user", s.User(), "remote", s.RemoteAddr(), "active", n)
+            }()
+            next(s)
+        }
+    }
+}
+
+// sessionHasEnv reports whether the SSH client sent the named env var.
+func sessionHasEnv(s ssh.Session, name string) bool {
+    for _, kv := range s.Environ() {
+        if strings.HasPrefix(kv, name+"=") {
+            return true
+        }
+    }
+    return false
+}
+
+// userRoot expands the per-user root template for an SSH username. It
+// falls back to the global ccRoot when the username is unsafe to put in a
+// path or the expanded directory does not exist.
+func userRoot(template, user, ccRoot string) string {
+    if user == "" || user == "." || user == ".." || strings.ContainsAny(user, `/\`) {
+        return ccRoot
+    }
+
+    root := strings.ReplaceAll(template, "{user}", user)
+    if info, err := os.Stat(root); err != nil || !info.IsDir() {
+        slog.Info("no per-user root; using CC_ROOT", "user", user, "root", root, "cc_root", ccRoot)
+        return ccRoot
+    }
+    return root
+}
+
+// authorizedKey is one parsed authorized_keys entry.
+type authorizedKey struct {
+    key   gossh.PublicKey
+    owner string // see keyOwner
+}
+
+// authorizedKeys caches the parsed authorized_keys file at path. It is
+// parsed again only when its modification time or size changes, so keys
+// can be added or revoked without restarting the server.
+type authorizedKeys struct {
+    path string
+
+    mu      sync.Mutex
+    loaded  bool
+    modTime time.Time
+    size    int64
+    entries []authorizedKey
+}
+
+// load returns the file's entries, re-parsing it if it changed.
+func (a *authorizedKeys) load() ([]authorizedKey, error) {
+    info, err := os.Stat(a.path)
+    if err != nil {
+        return nil, err
+    }
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    if a.loaded && info.ModTime().Equal(a.modTime) && info.Size() == a.size {
+        return a.entries, nil
+    }
+    data, err := os.ReadFile(a.path)
+    if err != nil {
+        return nil, err
+    }
+    a.entries = parseAuthorizedKeys(a.path, data)
+    a.loaded, a.modTime, a.size = true, info.ModTime(), info.Size()
+    slog.Info("loaded authorized_keys", "path", a.path, "keys", len(a.entries))
+    return a.entries, nil
+}
+
+// parseAuthorizedKeys parses data line by line. Lines that cannot be
+// parsed (malformed, or a key type this server does not support) are
+// logged and skipped rather than hiding the entries after them.
+func parseAuthorizedKeys(path string, data []byte) []authorizedKey {
+    var entries []authorizedKey
+    for i, line := range strings.Split(string(data), "\n") {
+        line = strings.TrimSpace(line)
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+        key, comment, _, _, err := gossh.ParseAuthorizedKey([]byte(line))
+        if err != nil {
+            slog.Warn("skipping authorized_keys entry", "path", path, "line", i+1, "err", err)
+            continue
+        }
+        entries = append(entries, authorizedKey{key: key, owner: keyOwner(comment)})
+    }
+    return entries
+}
+
+// authorizeKey reports whether key appears in keys, recording the owner
+// named in the matching entry's comment (see keyOwner) on ctx.
+func authorizeKey(keys *authorizedKeys, ctx ssh.Context, key ssh.PublicKey) bool {
+    entries, err := keys.load()
+    if err != nil {
+        slog.Error("rejecting SSH key: cannot read authorized_keys", "user", ctx.User(), "remote", ctx.RemoteAddr(), "path", keys.path, "err", err)
+        return false
+    }
+
+    for _, e := range entries {
+        if ssh.KeysEqual(e.key, key) {
+            ctx.SetValue(sshKeyOwnerKey{}, e.owner)
+            return true
+        }
+    }
+
+    slog.Warn("rejecting SSH key: unknown key", "user", ctx.User(), "remote", ctx.RemoteAddr(), "fingerprint", gossh.FingerprintSHA256(key))
+    return false
+}
+
+// ---------------------------------------------------------------------
+// State Dump (-dump-state)
+// ---------------------------------------------------------------------
+
+// stateDump is the JSON written by -dump-state: what the dashboard would
+// show, without starting the UI.
+type stateDump struct {
+    Root      string         `json:"cc_root"`
+    ScanError string         `json:"scan_error,omitempty"`
+    Repos     []repoDump     `json:"repos"`
+    Config    map[string]any `json:"config"`
+}
+
+// repoDump is one repo in a stateDump.
+type repoDump struct {
+    Name        string   `json:"name"`
+    Path        string   `json:"path"`
+    Branch      string   `json:"branch,omitempty"`
+    Dirty       bool     `json:"dirty,omitempty"`
+    Ahead       int      `json:"ahead,omitempty"`
+    Behind      int      `json:"behind,omitempty"`
+    Valid       bool     `json:"valid"`
+    MissingDocs []string `json:"missing_docs"`
+}
+
+// dumpState scans cfg.Root as the TUI does, checks each repo's required
+// docs and git state, and writes the result with the active config as
+// indented JSON. API keys are replaced by "(set)".
+func dumpState(cfg Config, w io.Writer) error {
+    items, scanErr := scanRepos(cfg.Root)
+    d := stateDump{Root: cfg.Root, Repos: []repoDump{}}
+    if scanErr != nil {
+        d.ScanError = scanErr.Error()
+    }
+
+    for _, r := range repoItems(items) {
+        git := lookupGitState(r.path)
+        missing := missingDocs(r.path, cfg.RequiredDocs)
+        d.Repos = append(d.Repos, repoDump{
+            Name:        r.name,
+            Path:        r.path,
+            Branch:      git.branch,
+            Dirty:       git.dirty,
+            Ahead:       git.ahead,
+            Behind:      git.behind,
+            Valid:       len(missing) == 0,
+            MissingDocs: missing,
+        })
+    }
+
+    for _, key := range []*string{&cfg.AI.OpenAI.APIKey, &cfg.AI.OpenRouter.APIKey, &cfg.AI.Gemini.APIKey} {
+        if *key != "" {
+            *key = "(set)"
+        }
+    }
+    // Round-trip through YAML so the config keys match the config file.
+    data, err := yaml.Marshal(cfg)
+    if err != nil {
+        return err
+    }
+    if err := yaml.Unmarshal(data, &d.Config); err != nil {
+        return err
+    }
+
+    enc := json.NewEncoder(w)
+    enc.SetIndent("", "  ")
+    return enc.Encode(d)
 }
 
 // ---------------------------------------------------------------------
@@ -1013,31 +5857,60 @@ func runSSHServer(ccRoot string) error {
 func main() {
     log.SetOutput(os.Stderr)
 
-    ccRoot := os.Getenv("CC_ROOT")
-    if ccRoot == "" {
-        home, err := os.UserHomeDir()
-        if err != nil {
-            log.Fatalf("could not determine home directory: %v", err)
+    dump := flag.Bool("dump-state", false, "print the repos, their validation status and the active config as JSON instead of starting the UI")
+    flag.Parse()
+
+    cfg, err := LoadConfig()
+    if err != nil {
+        log.Fatalf("error loading config: %v", err)
+    }
+
+    // Startup failures above stay on stderr; everything after goes to the
+    // log file so it cannot draw over the TUI.
+    logFile, err := setupLogging(cfg)
+    if err != nil {
+        log.Fatalf("error setting up logging: %v", err)
+    }
+    defer logFile.Close()
+    aiLimiter = newRateLimiter(cfg.AI.RequestsPerMinute)
+
+    if *dump {
+        if err := dumpState(cfg, os.Stdout); err != nil {
+            fatalf("error dumping state: %v", err)
         }
-        ccRoot = filepath.Join(home, "dev", "cloudcurio")
+        return
     }
 
-    if _, err := os.Stat(ccRoot); os.IsNotExist(err) {
-        log.Printf("[cloudcurio-tui] warning: CC_ROOT does not exist yet: %s", ccRoot)
-        log.Printf("Create it with your cc_boot.sh script or adjust CC_ROOT.")
+    if _, err := os.Stat(cfg.Root); os.IsNotExist(err) {
+        slog.Warn("CC_ROOT does not exist yet; create it with cc_boot.sh or adjust CC_ROOT", "root", cfg.Root)
     }
 
-    if os.Getenv("CC_TUI_SSH_SERVER") == "1" {
-        if err := runSSHServer(ccRoot); err != nil {
-            log.Fatalf("error running SSH server: %v", err)
+    if cfg.SSH.Enabled {
+        if err := runSSHServer(cfg); err != nil {
+            fatalf("error running SSH server: %v", err)
         }
         return
     }
 
-    m := initialModel(ccRoot)
+    m := initialModel(cfg)
 
-    p := tea.NewProgram(m, tea.WithAltScreen())
+    opts := []tea.ProgramOption{tea.WithAltScreen()}
+    if cfg.Mouse {
+        opts = append(opts, tea.WithMouseCellMotion())
+    }
+
+    p := tea.NewProgram(m, opts...)
     if _, err := p.Run(); err != nil {
-        log.Fatalf("error running TUI: %v", err)
+        fatalf("error running TUI: %v", err)
     }
 }
+
+// fatalf reports a fatal error on stderr as well as in the log file (the
+// standard log package writes to the file once setupLogging has run) and
+// exits.
+func fatalf(format string, args ...any) {
+    msg := fmt.Sprintf(format, args...)
+    slog.Error(msg)
+    fmt.Fprintln(os.Stderr, msg)
+    os.Exit(1)
+}
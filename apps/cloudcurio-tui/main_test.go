@@ -0,0 +1,282 @@
+package main
+
+import (
+    "crypto/ed25519"
+    "crypto/rand"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+
+    gossh "golang.org/x/crypto/ssh"
+)
+
+// testAuthorizedKey returns a new public key and its authorized_keys line
+// with comment.
+func testAuthorizedKey(t *testing.T, comment string) (gossh.PublicKey, string) {
+    t.Helper()
+    pub, _, err := ed25519.GenerateKey(rand.Reader)
+    if err != nil {
+        t.Fatal(err)
+    }
+    key, err := gossh.NewPublicKey(pub)
+    if err != nil {
+        t.Fatal(err)
+    }
+    line := strings.TrimSpace(string(gossh.MarshalAuthorizedKey(key)))
+    return key, line + " " + comment
+}
+
+func TestParseAuthorizedKeysSkipsBadLines(t *testing.T) {
+    alice, aliceLine := testAuthorizedKey(t, "alice@laptop")
+    bob, bobLine := testAuthorizedKey(t, "bob")
+    data := strings.Join([]string{
+        "# team keys",
+        aliceLine,
+        "ssh-unknown AAAAnotakey broken",
+        "garbage",
+        "",
+        bobLine,
+    }, "\n")
+
+    entries := parseAuthorizedKeys("authorized_keys", []byte(data))
+    if len(entries) != 2 {
+        t.Fatalf("got %d entries, want 2 (bad lines skipped, later keys kept)", len(entries))
+    }
+    for i, want := range []struct {
+        key   gossh.PublicKey
+        owner string
+    }{{alice, "alice"}, {bob, "bob"}} {
+        if string(entries[i].key.Marshal()) != string(want.key.Marshal()) || entries[i].owner != want.owner {
+            t.Errorf("entry %d: owner %q, want %q (or key mismatch)", i, entries[i].owner, want.owner)
+        }
+    }
+}
+
+func TestAuthorizedKeysReloadsOnChange(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "authorized_keys")
+    _, aliceLine := testAuthorizedKey(t, "alice")
+    _, bobLine := testAuthorizedKey(t, "bob")
+    if err := os.WriteFile(path, []byte(aliceLine+"\n"), 0o600); err != nil {
+        t.Fatal(err)
+    }
+
+    keys := &authorizedKeys{path: path}
+    entries, err := keys.load()
+    if err != nil || len(entries) != 1 {
+        t.Fatalf("load = %d entries, %v; want 1", len(entries), err)
+    }
+
+    if err := os.WriteFile(path, []byte(aliceLine+"\n"+bobLine+"\n"), 0o600); err != nil {
+        t.Fatal(err)
+    }
+    // Make sure the change is visible even on coarse mtime filesystems.
+    later := time.Now().Add(time.Minute)
+    if err := os.Chtimes(path, later, later); err != nil {
+        t.Fatal(err)
+    }
+    if entries, err = keys.load(); err != nil || len(entries) != 2 {
+        t.Fatalf("after edit: %d entries, %v; want 2", len(entries), err)
+    }
+}
+
+// useConfig points LoadConfig at a temp home with body as tui.yaml (no
+// file when body is empty) and clears the env overrides it reads.
+func useConfig(t *testing.T, body string) string {
+    t.Helper()
+    home := t.TempDir()
+    t.Setenv("HOME", home)
+    for _, name := range []string{
+        "CC_ROOT", "CC_THEME", "CC_LOG_FILE", "CC_LOG_LEVEL", "CC_AI_NOTIFY", "CC_AI_SYSTEM_PROMPT", "CC_AI_REQUESTS_PER_MINUTE",
+        "OPENAI_API_KEY", "OPENAI_MODEL", "OPENAI_TEMPERATURE", "OPENAI_MAX_TOKENS",
+        "OPENROUTER_API_KEY", "OPENROUTER_MODEL", "OPENROUTER_TEMPERATURE", "OPENROUTER_MAX_TOKENS",
+        "GEMINI_API_KEY", "GEMINI_MODEL", "GEMINI_TEMPERATURE", "GEMINI_MAX_TOKENS",
+        "CC_TUI_SSH_ADDR", "CC_TUI_SSH_KEY", "CC_TUI_SSH_AUTHORIZED_KEYS", "CC_TUI_SSH_ROOT_TEMPLATE",
+        "CC_TUI_SSH_SERVER", "CC_TUI_SSH_MAX_SESSIONS",
+    } {
+        t.Setenv(name, "")
+    }
+    path := filepath.Join(home, "tui.yaml")
+    t.Setenv("CC_CONFIG", path)
+    if body != "" {
+        if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+            t.Fatal(err)
+        }
+    }
+    return home
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+    home := useConfig(t, "")
+    cfg, err := LoadConfig()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if cfg.Root != filepath.Join(home, "dev", "cloudcurio") || cfg.RepoSort != sortByName || cfg.LogLevel != "info" {
+        t.Errorf("root %q, repo_sort %q, log_level %q; want the built-in defaults", cfg.Root, cfg.RepoSort, cfg.LogLevel)
+    }
+    if len(cfg.Docs) != len(defaultDocs()) || cfg.SSH.Addr != ":23234" || cfg.AI.OpenAI.Model != "gpt-4.1-mini" {
+        t.Errorf("docs %d, ssh.addr %q, openai model %q; want the built-in defaults", len(cfg.Docs), cfg.SSH.Addr, cfg.AI.OpenAI.Model)
+    }
+}
+
+func TestLoadConfigFileAndEnv(t *testing.T) {
+    home := useConfig(t, `
+root: ~/src
+theme: " Dark "
+repo_sort: MTIME
+ai:
+  openai:
+    model: gpt-4o
+ssh:
+  addr: ":2222"
+  max_sessions: 3
+`)
+    t.Setenv("OPENAI_MODEL", "gpt-4.1")
+    t.Setenv("CC_TUI_SSH_MAX_SESSIONS", "5")
+
+    cfg, err := LoadConfig()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if cfg.Root != filepath.Join(home, "src") || cfg.Theme != "dark" || cfg.RepoSort != "mtime" {
+        t.Errorf("root %q, theme %q, repo_sort %q; want ~ expanded and values normalized", cfg.Root, cfg.Theme, cfg.RepoSort)
+    }
+    if cfg.SSH.Addr != ":2222" || cfg.LogLevel != "info" {
+        t.Errorf("ssh.addr %q, log_level %q; want the file value and the untouched default", cfg.SSH.Addr, cfg.LogLevel)
+    }
+    if cfg.AI.OpenAI.Model != "gpt-4.1" || cfg.SSH.MaxSessions != 5 {
+        t.Errorf("openai model %q, max_sessions %d; want the env vars to win", cfg.AI.OpenAI.Model, cfg.SSH.MaxSessions)
+    }
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+    tests := []struct {
+        body, env, want string
+    }{
+        {"root: [unclosed\n", "", "parse config"},
+        {"repo_sort: random\n", "", "repo_sort"},
+        {"ai:\n  notify: loudly\n", "", "ai.notify"},
+        {"log_level: verbose\n", "", "log_level"},
+        {"root: /src\n", "abc", "CC_TUI_SSH_MAX_SESSIONS"},
+    }
+    for _, tt := range tests {
+        useConfig(t, tt.body)
+        if tt.env != "" {
+            t.Setenv("CC_TUI_SSH_MAX_SESSIONS", tt.env)
+        }
+        if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), tt.want) {
+            t.Errorf("config %q: error %v, want it to mention %s", tt.body, err, tt.want)
+        }
+    }
+}
+
+func TestNewKeyMap(t *testing.T) {
+    km := newKeyMap(map[string][]string{
+        actionToggleAI: {"A"},
+        "show_rules":   {"R", "f2"},
+        "no_such":      {"z"},
+    }, defaultDocs())
+
+    for key, want := range map[string]string{
+        "A":      actionToggleAI,
+        "R":      "show_rules",
+        "f2":     "show_rules",
+        "s":      "show_summary",
+        "ctrl+c": actionQuit,
+        "enter":  actionSelect,
+    } {
+        if got := km[key]; got != want {
+            t.Errorf("key %q -> %q, want %q", key, got, want)
+        }
+    }
+    // Remapped actions give up their default keys; unknown actions
+    // are ignored.
+    for _, key := range []string{"a", "r", "z"} {
+        if action, ok := km[key]; ok {
+            t.Errorf("key %q still bound to %s", key, action)
+        }
+    }
+
+    for action, want := range map[string]string{
+        actionQuit:    "q",
+        actionDocBack: "[",
+        "show_rules":  "R",
+        "no_such":     "",
+    } {
+        if got := km.keyFor(action); got != want {
+            t.Errorf("keyFor(%s) = %q, want %q", action, got, want)
+        }
+    }
+}
+
+func TestCheckDocs(t *testing.T) {
+    if err := checkDocs(defaultDocs(), nil); err != nil {
+        t.Errorf("default docs: %v", err)
+    }
+    // "q" is free once quit is moved off it.
+    ops := []DocShortcut{{File: "OPS.md", Key: "q", Aliases: []string{"ops"}}}
+    if err := checkDocs(ops, map[string][]string{actionQuit: {"ctrl+c"}}); err != nil {
+        t.Errorf("doc on a remapped key: %v", err)
+    }
+
+    tests := []struct {
+        docs []DocShortcut
+        want string
+    }{
+        {ops, `key "q" is already bound to quit`},
+        {[]DocShortcut{{File: " ", Key: "o"}}, "file is required"},
+        {[]DocShortcut{{File: "A.md", Aliases: []string{"notes"}}, {File: "B.md", Aliases: []string{"b", "Notes"}}}, `"notes" is also used by docs[0]`},
+        {[]DocShortcut{{File: "A.md", Key: "o"}, {File: "B.md", Key: "o"}}, `key "o" is already bound to show_a`},
+    }
+    for _, tt := range tests {
+        if err := checkDocs(tt.docs, nil); err == nil || !strings.Contains(err.Error(), tt.want) {
+            t.Errorf("checkDocs(%+v) = %v, want an error containing %s", tt.docs, err, tt.want)
+        }
+    }
+}
+
+func TestPushDocHistoryLeavesOtherModelsAlone(t *testing.T) {
+    var before model
+    before.docHistory = []docVisit{{dir: "/r", file: "README.md"}, {dir: "/r", file: "TODO.md"}}
+    before.docHistoryPos = 0
+    before.mainView.YOffset = 7
+
+    after := before.pushDocHistory(docVisit{dir: "/r", file: "AGENTS.md"})
+    if got := before.docHistory[0].offset; got != 0 {
+        t.Errorf("earlier model's offset changed to %d; history must be copied before writing", got)
+    }
+    if after.docHistory[0].offset != 7 || len(after.docHistory) != 2 || after.docHistory[1].file != "AGENTS.md" {
+        t.Errorf("history = %+v, want README.md at offset 7 then AGENTS.md", after.docHistory)
+    }
+}
+
+func TestBuildAIMessagesSendsRecentChat(t *testing.T) {
+    var m model
+    m.chatTurns = append(m.chatTurns, chatTurn{Role: "user", Text: "old"})
+    for i := 0; i < chatHistoryTurns/2; i++ {
+        m.chatTurns = append(m.chatTurns,
+            chatTurn{Role: "user", Text: "q"},
+            chatTurn{Role: "error", Text: "timeout"},
+            chatTurn{Role: "assistant", Text: "a"})
+    }
+
+    history := m.chatHistory()
+    if len(history) != chatHistoryTurns || history[0].Text != "q" {
+        t.Fatalf("history = %+v, want the last %d user/assistant turns", history, chatHistoryTurns)
+    }
+    messages := buildAIMessages("Be brief.", "next?", "Repo: r", history)
+    if len(messages) != chatHistoryTurns+3 {
+        t.Fatalf("%d messages, want system, context, %d turns and the prompt", len(messages), chatHistoryTurns)
+    }
+    if got := messages[2]; got.Role != "user" || got.Content != "q" {
+        t.Errorf("first history message = %+v, want the user's q", got)
+    }
+    if got := messages[3]; got.Role != "assistant" || got.Content != "a" {
+        t.Errorf("second history message = %+v, want the assistant's a", got)
+    }
+    if got := messages[len(messages)-1]; got.Role != "user" || got.Content != "next?" {
+        t.Errorf("last message = %+v, want the prompt", got)
+    }
+}
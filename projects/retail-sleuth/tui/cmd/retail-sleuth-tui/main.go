@@ -1,20 +1,282 @@
 package main
 
 import (
+    "encoding/csv"
+    "errors"
+    "flag"
+    "fmt"
+    "io"
     "log"
     "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
 
+    "github.com/charmbracelet/bubbles/list"
+    "github.com/charmbracelet/bubbles/viewport"
     tea "github.com/charmbracelet/bubbletea"
+    "github.com/charmbracelet/lipgloss"
+)
+
+// product is one catalog entry. Rows sharing a SKU are merged, each
+// contributing a point to history; price is the most recent one.
+type product struct {
+    name        string
+    sku         string
+    price       float64
+    currency    string
+    description string
+    category    string
+    history     []pricePoint
+}
+
+// pricePoint is one observed price.
+type pricePoint struct {
+    at    string // collected_at as written in the CSV
+    price float64
+}
+
+// productItem adapts a product to the bubbles list.
+type productItem struct {
+    p     product
+    index int // position in the catalog; SKUs may be blank or repeated
+}
+
+func (i productItem) Title() string { return i.p.name }
+
+func (i productItem) Description() string {
+    return fmt.Sprintf("SKU %s · %s", i.p.sku, formatPrice(i.p.price, i.p.currency))
+}
+
+func (i productItem) FilterValue() string { return i.p.name + " " + i.p.sku }
+
+func formatPrice(price float64, currency string) string {
+    if currency == "" || currency == "USD" {
+        return fmt.Sprintf("$%.2f", price)
+    }
+    return fmt.Sprintf("%.2f %s", price, currency)
+}
+
+// loadProducts reads a catalog CSV. The header row must contain
+// name, sku and price columns (any order, case-insensitive);
+// currency, description, category and collected_at are optional.
+// Rows with the same SKU form that product's price history, ordered
+// by collected_at (ISO dates sort correctly as strings).
+func loadProducts(path string) ([]product, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+
+    r := csv.NewReader(f)
+    r.FieldsPerRecord = -1
+    header, err := r.Read()
+    if err != nil {
+        return nil, fmt.Errorf("%s: reading header: %w", path, err)
+    }
+    col := make(map[string]int, len(header))
+    for i, h := range header {
+        col[strings.ToLower(strings.TrimSpace(h))] = i
+    }
+    for _, required := range []string{"name", "sku", "price"} {
+        if _, ok := col[required]; !ok {
+            return nil, fmt.Errorf("%s: missing %q column", path, required)
+        }
+    }
+
+    field := func(rec []string, name string) string {
+        i, ok := col[name]
+        if !ok || i >= len(rec) {
+            return ""
+        }
+        return strings.TrimSpace(rec[i])
+    }
+
+    var (
+        products []product
+        bySKU    = make(map[string]int)
+    )
+    for line := 2; ; line++ {
+        rec, err := r.Read()
+        if errors.Is(err, io.EOF) {
+            break
+        }
+        if err != nil {
+            return nil, fmt.Errorf("%s: %w", path, err)
+        }
+        price, err := strconv.ParseFloat(strings.TrimPrefix(field(rec, "price"), "$"), 64)
+        if err != nil {
+            return nil, fmt.Errorf("%s:%d: invalid price %q", path, line, field(rec, "price"))
+        }
+        point := pricePoint{at: field(rec, "collected_at"), price: price}
+
+        sku := field(rec, "sku")
+        if i, ok := bySKU[sku]; ok && sku != "" {
+            products[i].history = append(products[i].history, point)
+            continue
+        }
+        bySKU[sku] = len(products)
+        products = append(products, product{
+            name:        field(rec, "name"),
+            sku:         sku,
+            currency:    field(rec, "currency"),
+            description: field(rec, "description"),
+            category:    field(rec, "category"),
+            history:     []pricePoint{point},
+        })
+    }
+
+    for i := range products {
+        h := products[i].history
+        sort.SliceStable(h, func(a, b int) bool { return h[a].at < h[b].at })
+        products[i].price = h[len(h)-1].price
+    }
+    return products, nil
+}
+
+// exportHeader is the column order written by exportProducts; it is
+// a superset of what loadProducts accepts, so exports load back in.
+var exportHeader = []string{"name", "sku", "price", "currency", "category", "description", "collected_at"}
+
+// exportProducts writes products to path as CSV, one row per price
+// observation so the history survives a round trip. The file is
+// written to a temporary name and renamed into place.
+func exportProducts(path string, products []product) (err error) {
+    tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+    if err != nil {
+        return err
+    }
+    defer func() {
+        if err != nil {
+            tmp.Close()
+            os.Remove(tmp.Name())
+        }
+    }()
+
+    w := csv.NewWriter(tmp)
+    if err = w.Write(exportHeader); err != nil {
+        return err
+    }
+    for _, p := range products {
+        for _, pt := range p.history {
+            rec := []string{
+                p.name,
+                p.sku,
+                strconv.FormatFloat(pt.price, 'f', 2, 64),
+                p.currency,
+                p.category,
+                p.description,
+                pt.at,
+            }
+            if err = w.Write(rec); err != nil {
+                return err
+            }
+        }
+    }
+    w.Flush()
+    if err = w.Error(); err != nil {
+        return err
+    }
+    if err = tmp.Close(); err != nil {
+        return err
+    }
+    return os.Rename(tmp.Name(), path)
+}
+
+// defaultExportPath derives an export path next to the source CSV:
+// catalog.csv becomes catalog-filtered.csv.
+func defaultExportPath(csvPath string) string {
+    if csvPath == "" {
+        return "products-filtered.csv"
+    }
+    ext := filepath.Ext(csvPath)
+    return strings.TrimSuffix(csvPath, ext) + "-filtered" + ext
+}
+
+// renderDetails formats a product for the details pane.
+func renderDetails(p product) string {
+    var b strings.Builder
+    b.WriteString(titleStyle.Render(p.name) + "\n\n")
+    fmt.Fprintf(&b, "SKU:       %s\n", p.sku)
+    if p.category != "" {
+        fmt.Fprintf(&b, "Category:  %s\n", p.category)
+    }
+    fmt.Fprintf(&b, "Price:     %s\n", formatPrice(p.price, p.currency))
+    if p.description != "" {
+        b.WriteString("\n" + p.description + "\n")
+    }
+
+    b.WriteString("\n" + titleStyle.Render("Price history") + "\n")
+    if len(p.history) < 2 {
+        b.WriteString("(single observation)\n")
+    }
+    for i, pt := range p.history {
+        at := pt.at
+        if at == "" {
+            at = "(undated)"
+        }
+        change := ""
+        if i > 0 {
+            if d := pt.price - p.history[i-1].price; d != 0 {
+                change = fmt.Sprintf("  %+.2f", d)
+            }
+        }
+        fmt.Fprintf(&b, "%-12s %10s%s\n", at, formatPrice(pt.price, p.currency), change)
+    }
+    return b.String()
+}
+
+var (
+    paneStyle = lipgloss.NewStyle().
+        Border(lipgloss.RoundedBorder()).
+        BorderForeground(lipgloss.Color("62")).
+        Padding(0, 1)
+    titleStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("212"))
 )
 
 type model struct {
-    status string
+    products list.Model
+    details  viewport.Model
+    status   string
+
+    // exportPath is where e writes the visible products.
+    exportPath string
+
+    // shown is the catalog index of the product rendered in details
+    // (-1 for none), so the viewport is only rebuilt (and scrolled to
+    // top) on a change.
+    shown int
 }
 
-func initialModel() model {
-    return model{
-        status: "Retail Sleuth TUI – press q to quit",
+func initialModel(csvPath, exportPath string) model {
+    l := list.New(nil, list.NewDefaultDelegate(), 0, 0)
+    l.Title = "Products"
+    // q is handled in Update so it does not quit while filtering.
+    l.KeyMap.Quit.SetEnabled(false)
+
+    if exportPath == "" {
+        exportPath = defaultExportPath(csvPath)
+    }
+    m := model{products: l, details: viewport.New(0, 0), exportPath: exportPath, shown: -1}
+    if csvPath == "" {
+        m.status = "No catalog loaded – pass -csv <file> or set RETAIL_CSV. Press q to quit."
+        return m
+    }
+
+    products, err := loadProducts(csvPath)
+    if err != nil {
+        m.status = "Error: " + err.Error()
+        return m
+    }
+    items := make([]list.Item, len(products))
+    for i, p := range products {
+        items[i] = productItem{p: p, index: i}
     }
+    m.products.SetItems(items)
+    m.status = fmt.Sprintf("Loaded %d products from %s – ↑/↓ move, / filter, e export, PgUp/PgDn scroll details, q quit", len(products), csvPath)
+    return m
 }
 
 func (m model) Init() tea.Cmd {
@@ -23,21 +285,95 @@ func (m model) Init() tea.Cmd {
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
     switch msg := msg.(type) {
+    case tea.WindowSizeMsg:
+        // The list takes 40% of the width; details get the rest.
+        // Leave room for each pane's border and the status line.
+        fw, fh := paneStyle.GetFrameSize()
+        listWidth := msg.Width * 2 / 5
+        height := msg.Height - fh - 1
+        m.products.SetSize(listWidth-fw, height)
+        m.details.Width = msg.Width - listWidth - fw
+        m.details.Height = height
+        m.shown = -1 // re-render at the new width
+        m.syncDetails()
+        return m, nil
     case tea.KeyMsg:
-        switch msg.String() {
-        case "q", "ctrl+c":
-            return m, tea.Quit
+        if m.products.FilterState() != list.Filtering {
+            switch msg.String() {
+            case "q", "ctrl+c":
+                return m, tea.Quit
+            case "e":
+                m.exportVisible()
+                return m, nil
+            }
         }
     }
-    return m, nil
+
+    var cmds []tea.Cmd
+    var cmd tea.Cmd
+    m.products, cmd = m.products.Update(msg)
+    cmds = append(cmds, cmd)
+
+    // Page the details with pgup/pgdown; arrows belong to the list.
+    if key, ok := msg.(tea.KeyMsg); ok && (key.String() == "pgup" || key.String() == "pgdown") {
+        m.details, cmd = m.details.Update(msg)
+        cmds = append(cmds, cmd)
+    }
+    m.syncDetails()
+    return m, tea.Batch(cmds...)
+}
+
+// exportVisible writes the list's currently visible (filtered) items
+// to m.exportPath and reports the outcome in the status line.
+func (m *model) exportVisible() {
+    visible := m.products.VisibleItems()
+    if len(visible) == 0 {
+        m.status = "Nothing to export – no products match the current filter."
+        return
+    }
+    products := make([]product, 0, len(visible))
+    for _, it := range visible {
+        if pi, ok := it.(productItem); ok {
+            products = append(products, pi.p)
+        }
+    }
+    if err := exportProducts(m.exportPath, products); err != nil {
+        m.status = "Export failed: " + err.Error()
+        return
+    }
+    m.status = fmt.Sprintf("Exported %d products to %s", len(products), m.exportPath)
+}
+
+// syncDetails renders the selected product into the details pane.
+func (m *model) syncDetails() {
+    item, ok := m.products.SelectedItem().(productItem)
+    if !ok {
+        m.details.SetContent("No product selected.")
+        m.shown = -1
+        return
+    }
+    if item.index == m.shown {
+        return
+    }
+    m.shown = item.index
+    m.details.SetContent(lipgloss.NewStyle().Width(m.details.Width).Render(renderDetails(item.p)))
+    m.details.GotoTop()
 }
 
 func (m model) View() string {
-    return m.status + "\n"
+    panes := lipgloss.JoinHorizontal(lipgloss.Top,
+        paneStyle.Render(m.products.View()),
+        paneStyle.Render(m.details.View()),
+    )
+    return panes + "\n" + m.status
 }
 
 func main() {
-    p := tea.NewProgram(initialModel())
+    csvPath := flag.String("csv", os.Getenv("RETAIL_CSV"), "product catalog CSV (default: $RETAIL_CSV)")
+    exportPath := flag.String("out", "", "path written by the e (export) key (default: <csv>-filtered.csv)")
+    flag.Parse()
+
+    p := tea.NewProgram(initialModel(*csvPath, *exportPath), tea.WithAltScreen())
     if err := p.Start(); err != nil {
         log.Println("Error running program:", err)
         os.Exit(1)
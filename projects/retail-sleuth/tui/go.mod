@@ -3,6 +3,7 @@ module retail-sleuth-tui
 go 1.22
 
 require (
+    github.com/charmbracelet/bubbles v0.18.0
     github.com/charmbracelet/bubbletea v0.25.0
     github.com/charmbracelet/lipgloss v0.10.0
 )